@@ -7,11 +7,21 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/alertmanager"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/bitbucket"
 	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
 	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/dashboard"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/deployments"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/dora"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
 	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/github"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/gitlab"
 	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/jira"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/opsgenie"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/pagerduty"
 	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -28,16 +38,29 @@ var cat catalog.TeamsCatalog
 
 var configFile string
 
+var jql string
+
 func init() {
 	lvl := flag.String("log", "info", "debug, info, warn, error")
 	flag.StringVar(&configFile, "config.file", "config.yml", "Configuration file path")
+	flag.StringVar(&jql, "jira.jql", "", "JQL query for backfill-jira, overrides jira.backfill.jql from configuration")
 	flag.Parse()
 	logger = level.NewFilter(logger, level.Allow(level.ParseDefault(*lvl, level.InfoValue())))
 	github.SetLogger(logger)
+	gitlab.SetLogger(logger)
+	bitbucket.SetLogger(logger)
+	deployments.SetLogger(logger)
+	pagerduty.SetLogger(logger)
+	opsgenie.SetLogger(logger)
+	alertmanager.SetLogger(logger)
 	config.SetLogger(logger)
 	prom.SetLogger(logger)
 	jira.SetLogger(logger)
 	catalog.SetLogger(logger)
+	events.SetLogger(logger)
+	dora.SetLogger(logger)
+	dashboard.SetLogger(logger)
+	tracker.SetLogger(logger)
 }
 
 func HandlerWithSave(file string, handler func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
@@ -45,6 +68,7 @@ func HandlerWithSave(file string, handler func(w http.ResponseWriter, r *http.Re
 		handler(w, r)
 
 		prom.SaveMetricsToFile(file)
+		events.SaveToFile()
 	}
 }
 
@@ -53,19 +77,63 @@ func main() {
 	fileName = conf.Storage.File.Path
 
 	github.SetGitHubApi(conf.Github)
-
-	if conf.Catalog.Mode == "backstage" {
-		cat = catalog.NewCatalogFromBacktage(conf.Catalog.Endpoint)
-	} else {
-		cat = catalog.NewCatalogFromYaml(conf.GetTeamsString())
+	gitlab.SetGitlabApi(conf.Gitlab)
+	bitbucket.SetBitbucketApi(conf.Bitbucket)
+	bitbucket.SetDataCenterApi(conf.Bitbucket.DataCenter)
+	deployments.SetDeployments(conf.Deployments, conf.Gitlab, conf.Bitbucket.DataCenter)
+	pagerduty.SetPagerDuty(conf.PagerDuty)
+	opsgenie.SetOpsgenie(conf.Opsgenie)
+	if err := alertmanager.SetAlertmanager(conf.Alertmanager); err != nil {
+		_ = level.Error(logger).Log("alertmanager", "matchers", "error", err)
+		os.Exit(1)
 	}
+	jira.SetJiraApi(conf.Jira)
+	jira.SetDeploymentLinks(conf.Jira)
+	tracker.SetCorrelation(conf.Dora.Environment, conf.Dora.CorrelationWindow)
+
+	tracker.SetCommitLookup("github", github.GetGitHubApi().FindRepositoryFirstCommit)
+	tracker.SetCommitLookup("gitlab", gitlab.GetGitlabApi().FindFirstCommit)
+	tracker.SetCommitLookup("bitbucket", bitbucket.GetBitbucketApi().FindFirstCommit)
+	tracker.SetCommitLookup("bitbucket_data_center", bitbucket.GetDataCenterApi().FindFirstCommit)
+	tracker.SetAncestorLookup("github", github.GetGitHubApi().IsAncestor)
+	tracker.SetAncestorLookup("gitlab", gitlab.GetGitlabApi().IsAncestor)
+	tracker.SetAncestorLookup("bitbucket", bitbucket.GetBitbucketApi().IsAncestor)
+	tracker.SetAncestorLookup("bitbucket_data_center", bitbucket.GetDataCenterApi().IsAncestor)
+	tracker.SetHotfix(conf.Dora.Hotfix.Branches, conf.Dora.Hotfix.Labels)
+
+	composite := newCatalog()
+	prometheus.MustRegister(composite)
+	cat = composite
 
 	github.SetCatalog(cat)
+	gitlab.SetCatalog(cat)
+	bitbucket.SetCatalog(cat)
+	deployments.SetCatalog(cat)
+	pagerduty.SetCatalog(cat)
+	opsgenie.SetCatalog(cat)
+	alertmanager.SetCatalog(cat)
 	jira.SetCatalog(cat)
+	catalog.SetCatalog(cat)
+	tracker.SetCatalog(cat)
 
+	if conf.Catalog.HierarchyLabels {
+		prom.EnableHierarchyLabels()
+	}
 	exp = prom.NewExporter()
 	prom.SetExporter(exp)
 	prometheus.MustRegister(exp)
+
+	if conf.RemoteWrite.Url != "" {
+		writer, err := prom.NewRemoteWriter(conf.RemoteWrite)
+		if err != nil {
+			_ = level.Error(logger).Log("remote_write", conf.RemoteWrite.Url, "error", err)
+			os.Exit(1)
+		}
+		prom.SetRemoteWriter(writer)
+		writer.Start()
+		defer writer.Stop()
+	}
+
 	err := prom.LoadMetricsFromFile(fileName)
 
 	if err != nil {
@@ -73,9 +141,43 @@ func main() {
 		prom.SaveMetricsToFile(fileName)
 	}
 
+	store := events.NewStore(conf.Storage.Events.Path, conf.Storage.Events.Retention, conf.Storage.Events.MaxEvents)
+	err = store.Load()
+	if err != nil {
+		_ = level.Error(logger).Log("events", "loader", "file", conf.Storage.Events.Path, "error", err)
+		os.Exit(1)
+	}
+	events.SetStore(store)
+
+	dora.SetConfig(conf.Dora)
+	prometheus.MustRegister(dora.NewCollector())
+
+	if flag.Arg(0) == "backfill-jira" {
+		backfillJira()
+		return
+	}
+
 	http.HandleFunc("/api/github", HandlerWithSave(fileName, github.GithubAPIHandler))
+	http.HandleFunc("/api/gitlab", HandlerWithSave(fileName, gitlab.GitlabAPIHandler))
+	http.HandleFunc("/api/bitbucket", HandlerWithSave(fileName, bitbucket.BitbucketAPIHandler))
 	http.HandleFunc("/api/jira", HandlerWithSave(fileName, jira.JiraHandler))
-	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/api/pagerduty", HandlerWithSave(fileName, pagerduty.PagerDutyHandler))
+	http.HandleFunc("/api/opsgenie", HandlerWithSave(fileName, opsgenie.OpsgenieHandler))
+	http.HandleFunc("/api/alertmanager", HandlerWithSave(fileName, alertmanager.AlertmanagerHandler))
+	http.HandleFunc("/api/v1/deployments", HandlerWithSave(fileName, deployments.DeploymentsHandler))
+	http.HandleFunc("/api/v1/deployments/argocd", HandlerWithSave(fileName, deployments.ArgoCDHandler))
+	http.HandleFunc("/api/v1/deployments/flux", HandlerWithSave(fileName, deployments.FluxHandler))
+	http.HandleFunc("/api/v1/report", dora.ReportHandler)
+	http.HandleFunc("/api/v1/teams/", dora.TeamsHandler)
+	http.HandleFunc("/api/v1/events", events.EventsHandler)
+	http.HandleFunc("/api/v1/catalog", catalog.CatalogHandler)
+	http.HandleFunc("/api/v1/catalog/resolve", catalog.ResolveHandler)
+	http.HandleFunc("/dashboard/", dashboard.Handler)
+	http.Handle("/dashboard/static/", dashboard.StaticHandler())
+	http.Handle("/metrics", promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: conf.Server.OpenMetrics}),
+	))
 
 	_ = level.Info(logger).Log("server", "started", "port", conf.Server.Port)
 	err = http.ListenAndServe(":"+conf.Server.Port, nil)
@@ -83,3 +185,81 @@ func main() {
 		level.Error(logger).Log(err)
 	}
 }
+
+// newStaticCatalog loads teams from catalog.source when set, otherwise from teams of the configuration
+func newStaticCatalog() catalog.TeamsCatalog {
+	if conf.Catalog.Source == "" {
+		return catalog.NewCatalogFromYaml(conf.GetTeamsString())
+	}
+	if len(conf.Teams) > 0 {
+		_ = level.Warn(logger).Log("catalog", "source", "source", conf.Catalog.Source, "warning", "teams from configuration are ignored")
+	}
+
+	source, err := catalog.NewCatalogFromSource(conf.Catalog.Source, conf.Catalog.SourceToken, conf.Catalog.RefreshInterval)
+	if err != nil {
+		os.Exit(1)
+	}
+	return source
+}
+
+// newCatalog creates providers configured in catalog.providers, or the provider of catalog.mode
+// followed by static teams when providers are not set
+func newCatalog() *catalog.Composite {
+	static := newStaticCatalog()
+
+	names := conf.Catalog.Providers
+	if len(names) == 0 {
+		switch conf.Catalog.Mode {
+		case "backstage":
+			// static teams are used by backstage itself while it is unreachable
+			names = []string{"backstage"}
+		case "static":
+			names = []string{"static"}
+		default:
+			names = []string{conf.Catalog.Mode, "static"}
+		}
+	}
+
+	var providers []catalog.Provider
+	for _, name := range names {
+		var provider catalog.TeamsCatalog
+		switch name {
+		case "static":
+			provider = static
+		case "backstage":
+			var fallback catalog.TeamsCatalog
+			if len(conf.Catalog.Providers) == 0 {
+				fallback = static
+			}
+			provider = catalog.NewCatalogFromBacktage(conf.Catalog.BackstageConfig, fallback)
+		case "codeowners":
+			provider = github.NewCodeownersCatalog(github.GetGitHubApi(), conf.Catalog.RefreshInterval)
+		case "github_teams":
+			provider = github.NewTeamsCatalog(github.GetGitHubApi(), conf.Catalog.RefreshInterval)
+		default:
+			_ = level.Error(logger).Log("catalog", "provider", "name", name, "error", "unknown provider")
+			os.Exit(1)
+		}
+		providers = append(providers, catalog.Provider{Name: name, Catalog: provider})
+	}
+	return catalog.NewComposite(providers...)
+}
+
+// backfillJira imports historical incidents matching JQL query and saves metrics to storage
+func backfillJira() {
+	if jql == "" {
+		jql = conf.Jira.Backfill.JQL
+	}
+	if conf.Jira.BaseUrl == "" || jql == "" {
+		_ = level.Error(logger).Log("backfill", "jira", "error", "jira.base_url and jira.backfill.jql are required")
+		os.Exit(1)
+	}
+
+	_, err := jira.Backfill(jql, conf.Jira.Backfill.PageSize)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	prom.SaveMetricsToFile(fileName)
+	events.SaveToFile()
+}
@@ -0,0 +1,225 @@
+// Package alertmanager receives Prometheus Alertmanager notifications as incidents
+package alertmanager
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
+)
+
+var logger log.Logger
+
+func SetLogger(log log.Logger) {
+	logger = log
+	return
+}
+
+var cat catalog.TeamsCatalog
+
+func SetCatalog(catalog catalog.TeamsCatalog) {
+	cat = catalog
+	level.Info(logger).Log("alertmanager", "catalog service set")
+}
+
+var (
+	token        string
+	matchers     []Matcher
+	teamLabel    = "team"
+	serviceLabel = "service"
+)
+
+// Only critical alerts are incidents when matchers are not configured
+var defaultMatchers = []string{`severity="critical"`}
+
+// SetAlertmanager configures the receiver, error is returned when a matcher is invalid
+func SetAlertmanager(conf config.Alertmanager) error {
+	if len(conf.Matchers) == 0 {
+		conf.Matchers = defaultMatchers
+	}
+	parsed := make([]Matcher, 0, len(conf.Matchers))
+	for _, m := range conf.Matchers {
+		matcher, err := ParseMatcher(m)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, matcher)
+	}
+
+	token = conf.Token
+	matchers = parsed
+	if conf.TeamLabel != "" {
+		teamLabel = conf.TeamLabel
+	}
+	if conf.ServiceLabel != "" {
+		serviceLabel = conf.ServiceLabel
+	}
+	return nil
+}
+
+// Matcher selects alerts by label like Alertmanager routes do
+type Matcher struct {
+	Name     string
+	Operator string
+	Value    string
+	regexp   *regexp.Regexp
+}
+
+var matcherExpr = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|=)\s*(.*?)\s*$`)
+
+// ParseMatcher parses name="value" with =, !=, =~ or !~ operator, quotes are optional
+func ParseMatcher(s string) (Matcher, error) {
+	parts := matcherExpr.FindStringSubmatch(s)
+	if parts == nil {
+		return Matcher{}, fmt.Errorf("alertmanager: invalid matcher %s", s)
+	}
+
+	m := Matcher{Name: parts[1], Operator: parts[2], Value: parts[3]}
+	if len(m.Value) >= 2 && m.Value[0] == '"' && m.Value[len(m.Value)-1] == '"' {
+		m.Value = m.Value[1 : len(m.Value)-1]
+	}
+	if m.Operator == "=~" || m.Operator == "!~" {
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return Matcher{}, fmt.Errorf("alertmanager: invalid matcher %s: %w", s, err)
+		}
+		m.regexp = re
+	}
+	return m, nil
+}
+
+// Matches reports whether labels satisfy the matcher, missing label is an empty value
+func (m Matcher) Matches(labels map[string]string) bool {
+	value := labels[m.Name]
+	switch m.Operator {
+	case "=":
+		return value == m.Value
+	case "!=":
+		return value != m.Value
+	case "=~":
+		return m.regexp.MatchString(value)
+	default:
+		return !m.regexp.MatchString(value)
+	}
+}
+
+type Alert struct {
+	// firing or resolved
+	Status       string
+	Labels       map[string]string
+	Annotations  map[string]string
+	StartsAt     time.Time `json:"startsAt"`
+	EndsAt       time.Time `json:"endsAt"`
+	GeneratorURL string    `json:"generatorURL"`
+	Fingerprint  string
+}
+
+// Payload is sent by webhook receiver with alerts of the group
+type Payload struct {
+	Version  string
+	GroupKey string `json:"groupKey"`
+	Status   string
+	Receiver string
+	Alerts   []Alert
+}
+
+// Matches reports whether the alert satisfies all matchers
+func (alert Alert) Matches(matchers []Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(alert.Labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// fingerprint returns fingerprint sent by Alertmanager or hash of the labels
+func (alert Alert) fingerprint() string {
+	if alert.Fingerprint != "" {
+		return alert.Fingerprint
+	}
+	names := make([]string, 0, len(alert.Labels))
+	for name := range alert.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := fnv.New64a()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s=%s,", name, alert.Labels[name])
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// NewIncident maps alert occurrence to incident, the team is taken from team label or resolved by service
+func NewIncident(alert Alert) tracker.Incident {
+	service := alert.Labels[serviceLabel]
+	project := service
+	if project == "" {
+		project = alert.Labels["alertname"]
+	}
+
+	i := tracker.Incident{
+		// the same alert firing again starts a new incident
+		Id:      fmt.Sprintf("alertmanager/%s/%d", alert.fingerprint(), alert.StartsAt.Unix()),
+		Source:  "alertmanager",
+		Time:    alert.StartsAt,
+		Project: project,
+		Team:    alert.Labels[teamLabel],
+		Status:  alert.Status,
+	}
+	if i.Team == "" {
+		i.Team = catalog.UnknownTeam
+		if service != "" {
+			i.Team, i.Catalog = catalog.ResolveService(cat, service)
+		}
+	}
+	if i.Team == catalog.UnknownTeam {
+		i.Errors = append(i.Errors, fmt.Sprintf("catalog: no team for alert %s", project))
+	}
+	if alert.Status == "resolved" {
+		i.Resolved = alert.EndsAt
+		if i.Resolved.IsZero() {
+			i.Resolved = time.Now()
+		}
+	}
+	return i
+}
+
+func AlertmanagerHandler(w http.ResponseWriter, r *http.Request) {
+	if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var payload Payload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		level.Error(logger).Log("endpoint", "alertmanager", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recorded := 0
+	for _, alert := range payload.Alerts {
+		if !alert.Matches(matchers) {
+			continue
+		}
+		tracker.RecordIncident(NewIncident(alert))
+		recorded++
+	}
+
+	level.Debug(logger).Log("endpoint", "alertmanager", "group", payload.GroupKey, "status", payload.Status, "alerts", len(payload.Alerts), "incidents", recorded)
+	if recorded == 0 {
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
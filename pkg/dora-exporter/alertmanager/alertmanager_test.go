@@ -0,0 +1,136 @@
+package alertmanager_test
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/alertmanager"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/internal/testenv"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var start = strconv.FormatInt(time.Date(2021, 4, 28, 10, 0, 0, 0, time.UTC).Unix(), 10)
+
+func setup(t *testing.T, conf config.Alertmanager) (*events.Store, *prom.Exporter) {
+	store, exporter := testenv.Setup(t, alertmanager.SetLogger)
+
+	if err := alertmanager.SetAlertmanager(conf); err != nil {
+		t.Fatal(err)
+	}
+	alertmanager.SetCatalog(catalog.NewCatalogFromYaml("- name: Payments\n  services: [payments-api]\n"))
+	return store, exporter
+}
+
+func post(token, body string) int {
+	return testenv.Post(alertmanager.AlertmanagerHandler, "/api/alertmanager", body, "Authorization", "Bearer "+token).Code
+}
+
+type group struct {
+	Status string
+	EndsAt string
+}
+
+var (
+	firing   = group{Status: "firing", EndsAt: "0001-01-01T00:00:00Z"}
+	resolved = group{Status: "resolved", EndsAt: "2021-04-28T10:45:00Z"}
+)
+
+func TestParseMatcher(t *testing.T) {
+	labels := map[string]string{"severity": "critical", "env": "production"}
+
+	examples := map[string]bool{
+		`severity="critical"`:  true,
+		`severity = critical`:  true,
+		`severity!="critical"`: false,
+		`env=~"prod.*"`:        true,
+		`env=~"prod"`:          false,
+		`env!~"staging|dev"`:   true,
+		`team=""`:              true,
+		`team!=""`:             false,
+	}
+	for s, want := range examples {
+		m, err := alertmanager.ParseMatcher(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if got := m.Matches(labels); got != want {
+			t.Errorf("%s: wanted %v got %v", s, want, got)
+		}
+	}
+
+	for _, s := range []string{`severity`, `1abc="x"`, `env=~"("`} {
+		if _, err := alertmanager.ParseMatcher(s); err == nil {
+			t.Errorf("%s: wanted error", s)
+		}
+	}
+}
+
+func TestAlertmanagerHandler(t *testing.T) {
+	store, exporter := setup(t, config.Alertmanager{Token: "secret", Matchers: []string{`severity="critical"`}})
+
+	examples := []struct {
+		Name   string
+		Token  string
+		Group  group
+		Status int
+	}{
+		{Name: "wrong token", Token: "wrong", Group: firing, Status: http.StatusUnauthorized},
+		// repeated notifications of the firing group are counted once
+		{Name: "firing", Token: "secret", Group: firing, Status: http.StatusOK},
+		{Name: "repeated", Token: "secret", Group: firing, Status: http.StatusOK},
+		{Name: "resolved", Token: "secret", Group: resolved, Status: http.StatusOK},
+	}
+	for _, example := range examples {
+		if code := post(example.Token, testenv.Fixture(t, "group.json", example.Group)); code != example.Status {
+			t.Fatalf("%s: wanted %d got %d", example.Name, example.Status, code)
+		}
+	}
+
+	e, ok := store.Get("alertmanager/a1/" + start)
+	if !ok || e.Team != "Payments" || e.Project != "payments-api" || e.RestoreTime() != (45*time.Minute).Seconds() {
+		t.Errorf("Unexpected event %v %+v", ok, e)
+	}
+	e, ok = store.Get("alertmanager/b2/" + start)
+	if !ok || e.Team != "Checkout" || e.Project != "HighErrorRate" {
+		t.Errorf("Unexpected event %v %+v", ok, e)
+	}
+	if _, ok = store.Get("alertmanager/c3/" + start); ok {
+		t.Error("Wanted warning alert to be skipped")
+	}
+
+	expected := `
+# HELP jira_incidents The amount of incidents.
+# TYPE jira_incidents counter
+jira_incidents{project="HighErrorRate",team="Checkout"} 1
+jira_incidents{project="payments-api",team="Payments"} 1
+`
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "jira_incidents"); err != nil {
+		t.Error(err)
+	}
+	if got := testenv.Value(t, exporter, "jira_incidents_duration_sum", prometheus.Labels{"team": "Payments"}); got != (45 * time.Minute).Seconds() {
+		t.Errorf("Wanted 45m restore time got %v", got)
+	}
+}
+
+func TestAlertmanagerDefaultMatchers(t *testing.T) {
+	store, exporter := setup(t, config.Alertmanager{})
+
+	if code := post("", testenv.Fixture(t, "group.json", firing)); code != http.StatusOK {
+		t.Fatalf("Wanted 200 got %d", code)
+	}
+	if _, ok := store.Get("alertmanager/c3/" + start); ok {
+		t.Error("Wanted warning alert to be skipped without matchers")
+	}
+	if got := testenv.Value(t, exporter, "jira_incidents", nil); got != 2 {
+		t.Errorf("Wanted 2 critical incidents got %v", got)
+	}
+}
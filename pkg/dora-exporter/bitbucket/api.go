@@ -0,0 +1,286 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+)
+
+var logger log.Logger
+
+func SetLogger(log log.Logger) {
+	logger = log
+	return
+}
+
+// Maximal amount of pages fetched from paginated endpoints
+const maxPages = 10
+
+type BitbucketApi struct {
+	Username, Password, Token string
+
+	BaseUrl url.URL
+}
+
+var bitbucketApi BitbucketApi
+
+var webhookSecret string
+
+func SetBitbucketApi(conf config.Bitbucket) {
+	u, err := url.Parse(conf.BaseUrl)
+	if err != nil {
+		level.Error(logger).Log("component", "bitbucket_api", "base_url", conf.BaseUrl, "error", err)
+		u = &url.URL{}
+	}
+	bitbucketApi = BitbucketApi{BaseUrl: *u,
+		Username: conf.Username,
+		Password: conf.Password,
+		Token:    conf.Token}
+	webhookSecret = conf.WebhookSecret
+}
+
+func GetBitbucketApi() BitbucketApi {
+	return bitbucketApi
+}
+
+// Fetch requests path relative to API root, or absolute url of the next page
+func (api BitbucketApi) Fetch(path string) ([]byte, error) {
+	uri := api.BaseUrl.String() + "/2.0" + path
+	if strings.HasPrefix(path, "http") {
+		uri = path
+	}
+
+	req, err := http.NewRequest(http.MethodGet, uri, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	// app passwords use basic auth, repository and workspace access tokens are bearer
+	if api.Username != "" {
+		req.SetBasicAuth(api.Username, api.Password)
+	} else if api.Token != "" {
+		req.Header.Add("Authorization", "Bearer "+api.Token)
+	}
+
+	client := http.Client{Timeout: 15 * time.Second}
+
+	level.Debug(logger).Log("component", "bitbucket_api", "call", uri)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("bitbucket: %s returned %s", req.URL.Path, resp.Status)
+	}
+
+	return body, nil
+}
+
+// page is a page of paginated response
+type page struct {
+	Values json.RawMessage
+	Next   string
+}
+
+// FetchAll appends values of all pages to values, at most maxPages are fetched
+func (api BitbucketApi) FetchAll(path string, values func(json.RawMessage) error) error {
+	for i := 0; path != "" && i < maxPages; i++ {
+		resBody, err := api.Fetch(path)
+		if err != nil {
+			return err
+		}
+
+		var p page
+		if err = json.Unmarshal(resBody, &p); err != nil {
+			return err
+		}
+		if err = values(p.Values); err != nil {
+			return err
+		}
+		path = p.Next
+	}
+	return nil
+}
+
+type Commit struct {
+	Hash string
+	Date time.Time
+}
+
+type PullRequest struct {
+	Id    int
+	State string
+}
+
+type Deployment struct {
+	Uuid  string
+	State struct {
+		// COMPLETED, IN_PROGRESS or UNDEPLOYED
+		Name   string
+		Status struct {
+			// SUCCESSFUL, FAILED or STOPPED
+			Name string
+		}
+		StartedOn   time.Time `json:"started_on"`
+		CompletedOn time.Time `json:"completed_on"`
+		Url         string
+	}
+	Environment struct {
+		Uuid string
+	}
+	Release struct {
+		Url    string
+		Commit struct {
+			Hash string
+		}
+	}
+}
+
+type Environment struct {
+	Uuid string
+	Name string
+}
+
+// https://api.bitbucket.org/2.0/repositories/{{workspace}}/{{repo}}/commit/{{commit}}
+func (api BitbucketApi) CommitInfo(repository, hash string) (Commit, error) {
+	var commit Commit
+	resBody, err := api.Fetch(fmt.Sprintf("/repositories/%s/commit/%s", repository, hash))
+	if err != nil {
+		return commit, err
+	}
+
+	err = json.Unmarshal(resBody, &commit)
+	return commit, err
+}
+
+// https://api.bitbucket.org/2.0/repositories/{{workspace}}/{{repo}}/commit/{{commit}}/pullrequests
+func (api BitbucketApi) CommitPullRequests(repository, hash string) ([]PullRequest, error) {
+	var pullRequests []PullRequest
+	err := api.FetchAll(fmt.Sprintf("/repositories/%s/commit/%s/pullrequests", repository, hash), func(values json.RawMessage) error {
+		var p []PullRequest
+		err := json.Unmarshal(values, &p)
+		pullRequests = append(pullRequests, p...)
+		return err
+	})
+	return pullRequests, err
+}
+
+// https://api.bitbucket.org/2.0/repositories/{{workspace}}/{{repo}}/pullrequests/{{id}}/commits
+func (api BitbucketApi) PullRequestCommits(repository string, id int) ([]Commit, error) {
+	var commits []Commit
+	err := api.FetchAll(fmt.Sprintf("/repositories/%s/pullrequests/%d/commits", repository, id), func(values json.RawMessage) error {
+		var c []Commit
+		err := json.Unmarshal(values, &c)
+		commits = append(commits, c...)
+		return err
+	})
+	return commits, err
+}
+
+// Deployments returns the latest deployments of the repository, newest first
+// https://api.bitbucket.org/2.0/repositories/{{workspace}}/{{repo}}/deployments/
+func (api BitbucketApi) Deployments(repository string) ([]Deployment, error) {
+	var p struct {
+		Values []Deployment
+	}
+	resBody, err := api.Fetch(fmt.Sprintf("/repositories/%s/deployments/?sort=-state.started_on&pagelen=50", repository))
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(resBody, &p)
+	return p.Values, err
+}
+
+// https://api.bitbucket.org/2.0/repositories/{{workspace}}/{{repo}}/environments/{{uuid}}
+func (api BitbucketApi) Environment(repository, uuid string) (Environment, error) {
+	var environment Environment
+	resBody, err := api.Fetch(fmt.Sprintf("/repositories/%s/environments/%s", repository, url.PathEscape(uuid)))
+	if err != nil {
+		return environment, err
+	}
+
+	err = json.Unmarshal(resBody, &environment)
+	return environment, err
+}
+
+// https://api.bitbucket.org/2.0/repositories/{{workspace}}/{{repo}}/merge-base/{{commit}}..{{commit}}
+func (api BitbucketApi) MergeBase(repository, a, b string) (Commit, error) {
+	var commit Commit
+	resBody, err := api.Fetch(fmt.Sprintf("/repositories/%s/merge-base/%s..%s", repository, a, b))
+	if err != nil {
+		return commit, err
+	}
+
+	err = json.Unmarshal(resBody, &commit)
+	return commit, err
+}
+
+// IsAncestor reports whether ancestor commit is reachable from hash, i.e. it is their merge base
+func (api BitbucketApi) IsAncestor(repository, ancestor, hash string) (bool, error) {
+	base, err := api.MergeBase(repository, ancestor, hash)
+	if err != nil {
+		return false, fmt.Errorf("merge base of %s and %s: %w", ancestor, hash, err)
+	}
+	return base.Hash != "" && strings.HasPrefix(base.Hash, ancestor), nil
+}
+
+// FindFirstCommit returns the date of the first commit of the pull request which brought hash,
+// or the date of the commit itself when it has no pull request. Pull request is empty without one.
+func (api BitbucketApi) FindFirstCommit(repository, hash string) (time.Time, string, error) {
+	pullRequests, err := api.CommitPullRequests(repository, hash)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("pull requests of %s: %w", hash, err)
+	}
+
+	if len(pullRequests) == 0 {
+		commit, err := api.CommitInfo(repository, hash)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("commit %s: %w", hash, err)
+		}
+		level.Debug(logger).Log("repo", repository, "sha", hash, "date", "current_commit")
+		return commit.Date, "", nil
+	}
+
+	pullRequest := pullRequests[0]
+	for _, pr := range pullRequests {
+		if pr.State == "MERGED" {
+			pullRequest = pr
+			break
+		}
+	}
+	id := fmt.Sprint(pullRequest.Id)
+
+	commits, err := api.PullRequestCommits(repository, pullRequest.Id)
+	if err != nil {
+		return time.Time{}, id, fmt.Errorf("pull request %s: %w", id, err)
+	}
+	if len(commits) == 0 {
+		return time.Time{}, id, fmt.Errorf("pull request %s: no commits", id)
+	}
+
+	first := commits[0].Date
+	for _, commit := range commits {
+		if commit.Date.Before(first) {
+			first = commit.Date
+		}
+	}
+	level.Debug(logger).Log("repo", repository, "sha", hash, "PR", id, "date", "pr_first_commit")
+	return first, id, nil
+}
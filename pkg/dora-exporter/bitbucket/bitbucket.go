@@ -0,0 +1,193 @@
+package bitbucket
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
+)
+
+type Repository struct {
+	Name     string
+	FullName string `json:"full_name"`
+}
+
+// Slug returns repository slug used as repo label, name can contain spaces
+func (repository Repository) Slug() string {
+	return path.Base(repository.FullName)
+}
+
+// CommitStatusPayload is sent with repo:commit_status_created and repo:commit_status_updated events,
+// Bitbucket Pipelines report their results as commit statuses
+type CommitStatusPayload struct {
+	Repository   Repository
+	CommitStatus struct {
+		Name string
+		// SUCCESSFUL, FAILED, INPROGRESS or STOPPED
+		State  string
+		Key    string
+		Url    string
+		Commit struct {
+			Hash string
+		}
+		UpdatedOn time.Time `json:"updated_on"`
+	} `json:"commit_status"`
+}
+
+// Commit statuses of finished pipelines which can contain deployments
+var finishedStates = map[string]bool{"SUCCESSFUL": true, "FAILED": true, "STOPPED": true}
+
+// Deployment statuses mapped to status label values used by other sources
+var deploymentStatuses = map[string]string{"SUCCESSFUL": "success", "FAILED": "failed", "STOPPED": "stopped"}
+
+var cat catalog.TeamsCatalog
+
+func SetCatalog(catalog catalog.TeamsCatalog) {
+	cat = catalog
+	level.Info(logger).Log("bitbucket", "catalog service set")
+}
+
+// validSignature checks X-Hub-Signature HMAC of the body when webhook secret is configured
+func validSignature(signature string, body []byte) bool {
+	if webhookSecret == "" {
+		return true
+	}
+	mac := hmac.New(sha256.New, []byte(webhookSecret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+func BitbucketAPIHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validSignature(r.Header.Get("X-Hub-Signature"), body) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Header.Get("X-Event-Key") {
+	case "repo:commit_status_created", "repo:commit_status_updated":
+		commitStatus(w, body)
+	case "repo:refs_changed":
+		var payload RefsChangedPayload
+		if err = json.Unmarshal(body, &payload); err != nil {
+			level.Error(logger).Log("endpoint", "bitbucket", "error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// refs without deployment rules
+		if refsChanged(payload) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+		}
+	default:
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// commitStatus records completed Bitbucket Cloud deployments of the commit when its pipeline finishes
+func commitStatus(w http.ResponseWriter, body []byte) {
+	var payload CommitStatusPayload
+	err := json.NewDecoder(bytes.NewReader(body)).Decode(&payload)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "bitbucket", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !finishedStates[payload.CommitStatus.State] {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	deployments, err := bitbucketApi.Deployments(payload.Repository.FullName)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "bitbucket", "repository", payload.Repository.FullName, "error", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	var recorded int
+	for _, deployment := range deployments {
+		if deployment.Release.Commit.Hash != payload.CommitStatus.Commit.Hash || deployment.State.Name != "COMPLETED" {
+			continue
+		}
+		recorded++
+		// every later commit status lists the deployment again
+		if known, ok := events.Get(deploymentId(payload.Repository, deployment)); ok && known.Status == deploymentStatuses[deployment.State.Status.Name] {
+			continue
+		}
+		tracker.RecordDeployment(newDeployment(payload.Repository, deployment))
+	}
+
+	// pipelines without deployment steps
+	if recorded == 0 {
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func deploymentId(repository Repository, deployment Deployment) string {
+	return fmt.Sprintf("bitbucket/%s/%s", repository.FullName, strings.Trim(deployment.Uuid, "{}"))
+}
+
+func newDeployment(repository Repository, deployment Deployment) tracker.Deployment {
+	hash := deployment.Release.Commit.Hash
+	d := tracker.Deployment{
+		Id:         deploymentId(repository, deployment),
+		Source:     "bitbucket",
+		Time:       deployment.State.CompletedOn,
+		Repo:       repository.Slug(),
+		Status:     deploymentStatuses[deployment.State.Status.Name],
+		Sha:        hash,
+		Failed:     deployment.State.Status.Name == "FAILED",
+		Provider:   "bitbucket",
+		Repository: repository.FullName,
+	}
+	if d.Time.IsZero() {
+		d.Time = time.Now()
+	}
+	d.Team, d.Catalog = catalog.ResolveRepository(cat, repository.FullName)
+	if d.Team == catalog.UnknownTeam {
+		d.Errors = append(d.Errors, "catalog: no team for repository "+repository.FullName)
+	}
+
+	environment, err := bitbucketApi.Environment(repository.FullName, deployment.Environment.Uuid)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "bitbucket", "repository", repository.FullName, "environment", deployment.Environment.Uuid, "error", err)
+		d.Errors = append(d.Errors, "environment: "+err.Error())
+	}
+	d.Environment = environment.Name
+
+	firstCommitDate, pullRequest, err := bitbucketApi.FindFirstCommit(repository.FullName, hash)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "bitbucket", "repository", repository.FullName, "sha", hash, "error", err)
+		d.Errors = append(d.Errors, "lead time: "+err.Error())
+	} else {
+		d.LeadTime = d.Time.Sub(firstCommitDate).Seconds()
+		d.HasLeadTime = true
+	}
+
+	d.Exemplar = prom.NewExemplar(
+		"deployment_url", deployment.Release.Url,
+		"sha", hash,
+		"deployment_id", strings.Trim(deployment.Uuid, "{}"),
+		"pull_request", pullRequest,
+	)
+	return d
+}
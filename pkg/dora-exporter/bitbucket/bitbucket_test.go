@@ -0,0 +1,277 @@
+package bitbucket_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/bitbucket"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/internal/testenv"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const hash = "3a8b1e5c0f0e4f3d9a1b2c3d4e5f60718293a4b5"
+
+type commit struct {
+	Hash string `json:"hash,omitempty"`
+	Id   string `json:"id,omitempty"`
+	Date string `json:"date,omitempty"`
+	// Data Center author time in milliseconds
+	AuthorTimestamp int64 `json:"authorTimestamp,omitempty"`
+}
+
+type page struct {
+	Values     interface{} `json:"values"`
+	Next       string      `json:"next,omitempty"`
+	IsLastPage bool        `json:"isLastPage"`
+	// Data Center start of the next page
+	NextPageStart int `json:"nextPageStart,omitempty"`
+}
+
+type pullRequest struct {
+	Id    int    `json:"id"`
+	State string `json:"state"`
+}
+
+// bitbucketServer serves Cloud API under /2.0 and Data Center API under /rest/api/1.0
+func bitbucketServer(t *testing.T) *httptest.Server {
+	deployments := testenv.Fixture(t, "deployments.json", nil)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/rest/api/1.0/") {
+			dataCenter(t, w, r)
+			return
+		}
+		if user, password, _ := r.BasicAuth(); user != "bot" || password != "app-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		encoder := json.NewEncoder(w)
+		switch r.URL.Path {
+		case "/2.0/repositories/acme/payments-api/deployments/":
+			_, _ = w.Write([]byte(deployments))
+		// old is an ancestor of hash, other is on a diverged branch
+		case "/2.0/repositories/acme/payments-api/merge-base/old.." + hash:
+			_ = encoder.Encode(commit{Hash: "old0123"})
+		case "/2.0/repositories/acme/payments-api/merge-base/other.." + hash:
+			_ = encoder.Encode(commit{Hash: "base"})
+		case "/2.0/repositories/acme/payments-api/environments/{e1}":
+			_ = encoder.Encode(map[string]string{"uuid": "{e1}", "name": "Production"})
+		case "/2.0/repositories/acme/payments-api/commit/" + hash + "/pullrequests":
+			_ = encoder.Encode(page{Values: []pullRequest{{Id: 12, State: "MERGED"}}})
+		case "/2.0/repositories/acme/payments-api/pullrequests/12/commits":
+			if r.URL.Query().Get("page") == "2" {
+				_ = encoder.Encode(page{Values: []commit{{Hash: "a", Date: "2023-05-01T12:00:00Z"}}})
+				return
+			}
+			_ = encoder.Encode(page{Values: []commit{{Hash: "b", Date: "2023-05-02T08:00:00Z"}}, Next: server.URL + r.URL.Path + "?page=2"})
+		default:
+			t.Errorf("Unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+// dataCenter serves pull request of hash with two pages of commits, other commits have no pull requests
+func dataCenter(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer dc-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	encoder := json.NewEncoder(w)
+	switch r.URL.Path {
+	case "/rest/api/1.0/projects/PAY/repos/ledger/commits/" + hash + "/pull-requests":
+		_ = encoder.Encode(page{Values: []pullRequest{{Id: 5, State: "MERGED"}}, IsLastPage: true})
+	case "/rest/api/1.0/projects/PAY/repos/ledger/pull-requests/5/commits":
+		if r.URL.Query().Get("start") == "1" {
+			_ = encoder.Encode(page{Values: []commit{{Id: "a", AuthorTimestamp: 1682942400000}}, IsLastPage: true})
+			return
+		}
+		_ = encoder.Encode(page{Values: []commit{{Id: "b", AuthorTimestamp: 1683014400000}}, NextPageStart: 1})
+	case "/rest/api/1.0/projects/PAY/repos/ledger/commits":
+		// commits of until missing since hash
+		if r.URL.Query().Get("since") == hash && r.URL.Query().Get("until") == "old" {
+			_ = encoder.Encode(page{Values: []commit{}, IsLastPage: true})
+			return
+		}
+		_ = encoder.Encode(page{Values: []commit{{Id: "other"}}})
+	case "/rest/api/1.0/projects/PAY/repos/ledger/commits/c0ffee/pull-requests":
+		_ = encoder.Encode(page{Values: []pullRequest{}, IsLastPage: true})
+	case "/rest/api/1.0/projects/PAY/repos/ledger/commits/c0ffee":
+		_ = encoder.Encode(commit{Id: "c0ffee", AuthorTimestamp: 1683014400000})
+	default:
+		t.Errorf("Unexpected request %s", r.URL)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func setup(t *testing.T) (*events.Store, *prom.Exporter) {
+	store, exporter := testenv.Setup(t, bitbucket.SetLogger)
+
+	server := bitbucketServer(t)
+	t.Cleanup(server.Close)
+
+	bitbucket.SetBitbucketApi(config.Bitbucket{BaseUrl: server.URL, Username: "bot", Password: "app-password", WebhookSecret: "secret"})
+	bitbucket.SetDataCenterApi(config.BitbucketDataCenter{BaseUrl: server.URL, Token: "dc-token", Deployments: []config.RefRule{
+		{Repository: "PAY/*", Ref: "main", Environment: "production"},
+		{Repository: "PAY/*", Ref: "v*", Environment: "production"},
+	}})
+	bitbucket.SetCatalog(catalog.NewCatalogFromYaml("- name: Payments\n  github_repositories: [acme/payments-*, PAY/*]\n"))
+	return store, exporter
+}
+
+func post(event, body, secret string) int {
+	return testenv.Post(bitbucket.BitbucketAPIHandler, "/api/bitbucket", body,
+		"X-Event-Key", event, "X-Hub-Signature", "sha256="+testenv.Sign(secret, body)).Code
+}
+
+func TestCommitStatus(t *testing.T) {
+	store, exporter := setup(t)
+
+	// later statuses of the commit, e.g. of other pipelines, list the same deployment again
+	for i := 0; i < 2; i++ {
+		if code := post("repo:commit_status_updated", testenv.Fixture(t, "commit_status.json", map[string]string{"State": "SUCCESSFUL"}), "secret"); code != http.StatusOK {
+			t.Fatalf("Wanted 200 got %d", code)
+		}
+	}
+
+	e, ok := store.Get("bitbucket/acme/payments-api/d1")
+	if !ok {
+		t.Fatal("Wanted deployment event")
+	}
+	if e.Team != "Payments" || e.Repo != "payments-api" || e.Environment != "Production" || e.Status != "success" || e.Failed {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	// the first commit is on the second page
+	if e.LeadTime != (24 * time.Hour).Seconds() {
+		t.Errorf("Wanted 24h lead time got %v", e.LeadTime)
+	}
+	if len(store.Query(events.Query{})) != 1 {
+		t.Errorf("Wanted only deployment of the commit")
+	}
+
+	labels := prometheus.Labels{"repo": "payments-api", "environment": "Production", "team": "Payments", "status": "success"}
+	if got := testenv.Value(t, exporter, "github_deployments_total", labels); got != 1 {
+		t.Errorf("Wanted deployment counted once got %v", got)
+	}
+	if got := testenv.Value(t, exporter, "github_deployments_lead_time_seconds", labels); got != 1 {
+		t.Errorf("Wanted one lead time observation got %v", got)
+	}
+}
+
+func TestCommitStatusSkipped(t *testing.T) {
+	setup(t)
+
+	examples := []struct {
+		Name   string
+		Event  string
+		Body   string
+		Secret string
+		Status int
+	}{
+		{
+			Name:   "pipeline in progress",
+			Event:  "repo:commit_status_updated",
+			Body:   testenv.Fixture(t, "commit_status.json", map[string]string{"State": "INPROGRESS"}),
+			Secret: "secret",
+			Status: http.StatusAccepted,
+		},
+		{Name: "push", Event: "repo:push", Body: `{}`, Secret: "secret", Status: http.StatusAccepted},
+		{
+			Name:   "wrong signature",
+			Event:  "repo:commit_status_updated",
+			Body:   testenv.Fixture(t, "commit_status.json", map[string]string{"State": "SUCCESSFUL"}),
+			Secret: "wrong",
+			Status: http.StatusUnauthorized,
+		},
+	}
+	for _, example := range examples {
+		if code := post(example.Event, example.Body, example.Secret); code != example.Status {
+			t.Errorf("%s: wanted %d got %d", example.Name, example.Status, code)
+		}
+	}
+}
+
+func TestDataCenterRefsChanged(t *testing.T) {
+	store, exporter := setup(t)
+
+	examples := []struct {
+		Name   string
+		Branch string
+		Tag    string
+		Status int
+	}{
+		{Name: "release", Branch: "main", Tag: "v1.2.0", Status: http.StatusOK},
+		// redelivered push isn't counted again
+		{Name: "redelivered", Branch: "main", Tag: "v1.2.0", Status: http.StatusOK},
+		// feature branches aren't deployed
+		{Name: "feature", Branch: "develop", Tag: "nightly", Status: http.StatusAccepted},
+	}
+	for _, example := range examples {
+		body := testenv.Fixture(t, "refs_changed.json", example)
+		if code := post("repo:refs_changed", body, "secret"); code != example.Status {
+			t.Fatalf("%s: wanted %d got %d", example.Name, example.Status, code)
+		}
+	}
+
+	e, ok := store.Get("bitbucket/PAY/ledger/main/" + hash)
+	if !ok {
+		t.Fatal("Wanted deployment of main branch")
+	}
+	if e.Team != "Payments" || e.Repo != "ledger" || e.Environment != "production" || e.Status != "success" || e.Failed {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	// pushed at 12:00 UTC, the first commit of the pull request is on the second page
+	if e.LeadTime != (24 * time.Hour).Seconds() {
+		t.Errorf("Wanted 24h lead time got %v", e.LeadTime)
+	}
+
+	tag, ok := store.Get("bitbucket/PAY/ledger/v1.2.0/c0ffee")
+	if !ok || tag.Version != "v1.2.0" || tag.LeadTime != (4*time.Hour).Seconds() {
+		t.Errorf("Unexpected tag deployment %+v", tag)
+	}
+	if got := len(store.Query(events.Query{})); got != 2 {
+		t.Errorf("Wanted deployments of main and release tag got %d", got)
+	}
+
+	labels := prometheus.Labels{"repo": "ledger", "environment": "production", "team": "Payments", "status": "success"}
+	if got := testenv.Value(t, exporter, "github_deployments_total", labels); got != 2 {
+		t.Errorf("Wanted 2 deployments got %v", got)
+	}
+}
+
+func TestIsAncestor(t *testing.T) {
+	setup(t)
+
+	examples := []struct {
+		Name       string
+		IsAncestor func(repository, ancestor, hash string) (bool, error)
+		Repository string
+		Ancestor   string
+		Want       bool
+	}{
+		{"cloud", bitbucket.GetBitbucketApi().IsAncestor, "acme/payments-api", "old", true},
+		{"cloud", bitbucket.GetBitbucketApi().IsAncestor, "acme/payments-api", "other", false},
+		{"data center", bitbucket.GetDataCenterApi().IsAncestor, "PAY/ledger", "old", true},
+		{"data center", bitbucket.GetDataCenterApi().IsAncestor, "PAY/ledger", "other", false},
+	}
+	for _, example := range examples {
+		got, err := example.IsAncestor(example.Repository, example.Ancestor, hash)
+		if err != nil {
+			t.Errorf("%s %s: %s", example.Name, example.Ancestor, err)
+			continue
+		}
+		if got != example.Want {
+			t.Errorf("%s %s: wanted %v got %v", example.Name, example.Ancestor, example.Want, got)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
+)
+
+// Page size of Data Center paginated endpoints
+const dataCenterPageSize = 100
+
+// DataCenterApi is Bitbucket Data Center REST API client, repositories are named PROJECT/slug
+type DataCenterApi struct {
+	Token string
+
+	BaseUrl url.URL
+}
+
+var dataCenterApi DataCenterApi
+
+var refRules []config.RefRule
+
+// SetDataCenterApi configures Data Center API and rules mapping pushed refs to deployments
+func SetDataCenterApi(conf config.BitbucketDataCenter) {
+	u, err := url.Parse(conf.BaseUrl)
+	if err != nil {
+		level.Error(logger).Log("component", "bitbucket_data_center_api", "base_url", conf.BaseUrl, "error", err)
+		u = &url.URL{}
+	}
+	dataCenterApi = DataCenterApi{BaseUrl: *u, Token: conf.Token}
+	refRules = conf.Deployments
+}
+
+func GetDataCenterApi() DataCenterApi {
+	return dataCenterApi
+}
+
+// Fetch requests path relative to /rest/api/1.0
+func (api DataCenterApi) Fetch(path string, query url.Values) ([]byte, error) {
+	uri := api.BaseUrl
+	uri.Path = strings.TrimSuffix(uri.Path, "/") + "/rest/api/1.0" + path
+	uri.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, uri.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if api.Token != "" {
+		req.Header.Add("Authorization", "Bearer "+api.Token)
+	}
+
+	client := http.Client{Timeout: 15 * time.Second}
+
+	level.Debug(logger).Log("component", "bitbucket_data_center_api", "call", uri.String())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("bitbucket: %s returned %s", uri.Path, resp.Status)
+	}
+
+	return body, nil
+}
+
+// dataCenterPage is a page of paginated response
+type dataCenterPage struct {
+	Values        json.RawMessage
+	IsLastPage    bool `json:"isLastPage"`
+	NextPageStart int  `json:"nextPageStart"`
+}
+
+// FetchAll appends values of all pages to values, at most maxPages are fetched
+func (api DataCenterApi) FetchAll(path string, values func(json.RawMessage) error) error {
+	start := 0
+	for i := 0; i < maxPages; i++ {
+		resBody, err := api.Fetch(path, url.Values{"start": {strconv.Itoa(start)}, "limit": {strconv.Itoa(dataCenterPageSize)}})
+		if err != nil {
+			return err
+		}
+
+		var p dataCenterPage
+		if err = json.Unmarshal(resBody, &p); err != nil {
+			return err
+		}
+		if err = values(p.Values); err != nil {
+			return err
+		}
+		if p.IsLastPage {
+			return nil
+		}
+		start = p.NextPageStart
+	}
+	return nil
+}
+
+type DataCenterCommit struct {
+	Id string
+	// Milliseconds since epoch
+	AuthorTimestamp int64 `json:"authorTimestamp"`
+}
+
+func (commit DataCenterCommit) Date() time.Time {
+	return time.UnixMilli(commit.AuthorTimestamp).UTC()
+}
+
+// repositoryPath returns /projects/{{key}}/repos/{{slug}} of repository named PROJECT/slug
+func repositoryPath(repository string) string {
+	project, slug, _ := strings.Cut(repository, "/")
+	return fmt.Sprintf("/projects/%s/repos/%s", url.PathEscape(project), url.PathEscape(slug))
+}
+
+// https://bitbucket.acme.io/rest/api/1.0/projects/{{key}}/repos/{{slug}}/commits/{{commit}}
+func (api DataCenterApi) CommitInfo(repository, hash string) (DataCenterCommit, error) {
+	var commit DataCenterCommit
+	resBody, err := api.Fetch(fmt.Sprintf("%s/commits/%s", repositoryPath(repository), hash), nil)
+	if err != nil {
+		return commit, err
+	}
+
+	err = json.Unmarshal(resBody, &commit)
+	return commit, err
+}
+
+// https://bitbucket.acme.io/rest/api/1.0/projects/{{key}}/repos/{{slug}}/commits/{{commit}}/pull-requests
+func (api DataCenterApi) CommitPullRequests(repository, hash string) ([]PullRequest, error) {
+	var pullRequests []PullRequest
+	err := api.FetchAll(fmt.Sprintf("%s/commits/%s/pull-requests", repositoryPath(repository), hash), func(values json.RawMessage) error {
+		var p []PullRequest
+		err := json.Unmarshal(values, &p)
+		pullRequests = append(pullRequests, p...)
+		return err
+	})
+	return pullRequests, err
+}
+
+// https://bitbucket.acme.io/rest/api/1.0/projects/{{key}}/repos/{{slug}}/pull-requests/{{id}}/commits
+func (api DataCenterApi) PullRequestCommits(repository string, id int) ([]DataCenterCommit, error) {
+	var commits []DataCenterCommit
+	err := api.FetchAll(fmt.Sprintf("%s/pull-requests/%d/commits", repositoryPath(repository), id), func(values json.RawMessage) error {
+		var c []DataCenterCommit
+		err := json.Unmarshal(values, &c)
+		commits = append(commits, c...)
+		return err
+	})
+	return commits, err
+}
+
+// IsAncestor reports whether ancestor commit is reachable from hash, i.e. no commit of ancestor is missing in hash
+// https://bitbucket.acme.io/rest/api/1.0/projects/{{key}}/repos/{{slug}}/commits?since={{hash}}&until={{ancestor}}
+func (api DataCenterApi) IsAncestor(repository, ancestor, hash string) (bool, error) {
+	var p struct {
+		Values []DataCenterCommit
+	}
+	resBody, err := api.Fetch(repositoryPath(repository)+"/commits", url.Values{"since": {hash}, "until": {ancestor}, "limit": {"1"}})
+	if err != nil {
+		return false, fmt.Errorf("commits of %s since %s: %w", ancestor, hash, err)
+	}
+
+	err = json.Unmarshal(resBody, &p)
+	return len(p.Values) == 0, err
+}
+
+// FindFirstCommit returns the date of the first commit of the pull request which brought hash,
+// or the date of the commit itself when it has no pull request. Pull request is empty without one.
+func (api DataCenterApi) FindFirstCommit(repository, hash string) (time.Time, string, error) {
+	pullRequests, err := api.CommitPullRequests(repository, hash)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("pull requests of %s: %w", hash, err)
+	}
+
+	if len(pullRequests) == 0 {
+		commit, err := api.CommitInfo(repository, hash)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("commit %s: %w", hash, err)
+		}
+		level.Debug(logger).Log("repo", repository, "sha", hash, "date", "current_commit")
+		return commit.Date(), "", nil
+	}
+
+	pullRequest := pullRequests[0]
+	for _, pr := range pullRequests {
+		if pr.State == "MERGED" {
+			pullRequest = pr
+			break
+		}
+	}
+	id := fmt.Sprint(pullRequest.Id)
+
+	commits, err := api.PullRequestCommits(repository, pullRequest.Id)
+	if err != nil {
+		return time.Time{}, id, fmt.Errorf("pull request %s: %w", id, err)
+	}
+	if len(commits) == 0 {
+		return time.Time{}, id, fmt.Errorf("pull request %s: no commits", id)
+	}
+
+	first := commits[0].Date()
+	for _, commit := range commits {
+		if commit.Date().Before(first) {
+			first = commit.Date()
+		}
+	}
+	level.Debug(logger).Log("repo", repository, "sha", hash, "PR", id, "date", "pr_first_commit")
+	return first, id, nil
+}
+
+// Webhook date like 2017-09-19T09:58:11+1000
+const dataCenterTime = "2006-01-02T15:04:05-0700"
+
+type DataCenterTime struct {
+	time.Time
+}
+
+func (t *DataCenterTime) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		return nil
+	}
+	for _, layout := range []string{dataCenterTime, time.RFC3339} {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("bitbucket: invalid time %s", s)
+}
+
+type DataCenterRepository struct {
+	Slug    string
+	Name    string
+	Project struct {
+		Key string
+	}
+}
+
+// FullName returns repository name like PROJECT/slug used by catalog and API
+func (repository DataCenterRepository) FullName() string {
+	return repository.Project.Key + "/" + repository.Slug
+}
+
+// RefsChangedPayload is sent by Bitbucket Data Center with repo:refs_changed event when branches or tags are pushed
+type RefsChangedPayload struct {
+	Date       DataCenterTime
+	Repository DataCenterRepository
+	Changes    []struct {
+		Ref struct {
+			Id        string
+			DisplayId string `json:"displayId"`
+			// BRANCH or TAG
+			Type string
+		}
+		ToHash string `json:"toHash"`
+		// ADD, UPDATE or DELETE
+		Type string
+	}
+}
+
+func glob(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
+
+// MatchRefRule returns the first rule matching pushed ref of the repository
+func MatchRefRule(rules []config.RefRule, repository, ref string) (config.RefRule, bool) {
+	for _, rule := range rules {
+		if glob(rule.Repository, repository) && glob(rule.Ref, ref) {
+			return rule, true
+		}
+	}
+	return config.RefRule{}, false
+}
+
+// refsChanged records pushed refs matching deployment rules, returns amount of deployed refs
+func refsChanged(payload RefsChangedPayload) int {
+	fullName := payload.Repository.FullName()
+	at := payload.Date.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	var recorded int
+	for _, change := range payload.Changes {
+		if change.Type == "DELETE" {
+			continue
+		}
+		rule, ok := MatchRefRule(refRules, fullName, change.Ref.DisplayId)
+		if !ok {
+			level.Debug(logger).Log("endpoint", "bitbucket", "repository", fullName, "ref", change.Ref.DisplayId, "rule", "not_found")
+			continue
+		}
+
+		d := tracker.Deployment{
+			Id:          fmt.Sprintf("bitbucket/%s/%s/%s", fullName, change.Ref.DisplayId, change.ToHash),
+			Source:      "bitbucket",
+			Time:        at,
+			Repo:        payload.Repository.Slug,
+			Environment: rule.Environment,
+			Status:      "success",
+			Sha:         change.ToHash,
+			Ref:         change.Ref.DisplayId,
+			Provider:    "bitbucket_data_center",
+			Repository:  fullName,
+		}
+		if change.Ref.Type == "TAG" {
+			d.Version = change.Ref.DisplayId
+		}
+		recorded++
+		// redelivered push was recorded already
+		if known, ok := events.Get(d.Id); ok && known.Status == d.Status {
+			continue
+		}
+		d.Team, d.Catalog = catalog.ResolveRepository(cat, fullName)
+		if d.Team == catalog.UnknownTeam {
+			d.Errors = append(d.Errors, "catalog: no team for repository "+fullName)
+		}
+
+		firstCommitDate, pullRequest, err := dataCenterApi.FindFirstCommit(fullName, change.ToHash)
+		if err != nil {
+			level.Error(logger).Log("endpoint", "bitbucket", "repository", fullName, "sha", change.ToHash, "error", err)
+			d.Errors = append(d.Errors, "lead time: "+err.Error())
+		} else {
+			d.LeadTime = at.Sub(firstCommitDate).Seconds()
+			d.HasLeadTime = true
+		}
+		d.Exemplar = prom.NewExemplar(
+			"sha", change.ToHash,
+			"ref", change.Ref.DisplayId,
+			"pull_request", pullRequest,
+		)
+
+		tracker.RecordDeployment(d)
+	}
+	return recorded
+}
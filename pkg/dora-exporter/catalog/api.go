@@ -0,0 +1,83 @@
+package catalog
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/log/level"
+)
+
+var served TeamsCatalog
+
+// SetCatalog sets catalog served by the API
+func SetCatalog(catalog TeamsCatalog) {
+	served = catalog
+}
+
+// ProviderTeams are teams known to the provider, nil when provider can't list its teams
+type ProviderTeams struct {
+	Name  string `json:"name"`
+	Teams Teams  `json:"teams"`
+}
+
+type CatalogResponse struct {
+	Providers []ProviderTeams `json:"providers"`
+}
+
+// NewCatalogResponse lists teams of every provider of the catalog in order they are asked
+func NewCatalogResponse(catalog TeamsCatalog) CatalogResponse {
+	providers := []Provider{{Name: "catalog", Catalog: catalog}}
+	if composite, ok := catalog.(*Composite); ok {
+		providers = composite.Providers
+	}
+
+	response := CatalogResponse{Providers: []ProviderTeams{}}
+	for _, p := range providers {
+		provider := ProviderTeams{Name: p.Name}
+		if lister, ok := p.Catalog.(Lister); ok {
+			provider.Teams = lister.Teams()
+		}
+		response.Providers = append(response.Providers, provider)
+	}
+	return response
+}
+
+// CatalogHandler serves /api/v1/catalog
+func CatalogHandler(w http.ResponseWriter, r *http.Request) {
+	if served == nil {
+		http.Error(w, "catalog is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(NewCatalogResponse(served))
+	if err != nil {
+		level.Error(logger).Log("endpoint", "catalog", "error", err)
+	}
+}
+
+// ResolveHandler serves /api/v1/catalog/resolve?repo= or ?project= explaining how the owner was resolved
+func ResolveHandler(w http.ResponseWriter, r *http.Request) {
+	if served == nil {
+		http.Error(w, "catalog is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var explanation Explanation
+	query := r.URL.Query()
+	switch {
+	case query.Get("repo") != "":
+		explanation = ExplainRepository(served, query.Get("repo"))
+	case query.Get("project") != "":
+		explanation = ExplainProject(served, query.Get("project"))
+	default:
+		http.Error(w, "repo or project is required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(explanation)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "catalog_resolve", "error", err)
+	}
+}
@@ -0,0 +1,74 @@
+package catalog_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+)
+
+func TestResolveHandler(t *testing.T) {
+	catalog.SetLogger(logger)
+	composite := catalog.NewComposite(
+		catalog.Provider{Name: "overrides", Catalog: SetupCatalog()},
+		catalog.Provider{Name: "patterns", Catalog: catalog.NewCatalogFromYaml(patterns)},
+	)
+	catalog.SetCatalog(composite)
+
+	examples := []struct {
+		query string
+		want  catalog.Explanation
+	}{
+		{"repo=mprokopov/alfred", catalog.Explanation{Team: "Risk", Provider: "overrides", Rule: "exact", Match: "mprokopov/alfred"}},
+		{"repo=acme/sandbox-test", catalog.Explanation{Team: "Fallback", Provider: "patterns", Rule: "pattern", Match: "*/*", Skipped: []string{
+			"overrides: no match",
+			"patterns: Platform: acme/* excluded by acme/sandbox-*",
+		}}},
+		{"project=PAY", catalog.Explanation{Team: "Payments", Provider: "overrides", Rule: "project", Match: "PAY"}},
+		{"project=NONE", catalog.Explanation{Team: catalog.UnknownTeam, Skipped: []string{"overrides: no match", "patterns: no match"}}},
+	}
+
+	for _, example := range examples {
+		rec := httptest.NewRecorder()
+		catalog.ResolveHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/catalog/resolve?"+example.query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: wanted 200 got %d", example.query, rec.Code)
+		}
+
+		var got catalog.Explanation
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, example.want) {
+			t.Errorf("%s: wanted %+v got %+v", example.query, example.want, got)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	catalog.ResolveHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/catalog/resolve", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Wanted 400 got %d", rec.Code)
+	}
+}
+
+func TestCatalogHandler(t *testing.T) {
+	catalog.SetLogger(logger)
+	catalog.SetCatalog(catalog.NewComposite(catalog.Provider{Name: "static", Catalog: SetupCatalog()}))
+
+	rec := httptest.NewRecorder()
+	catalog.CatalogHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/catalog", nil))
+
+	var got catalog.CatalogResponse
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Providers) != 1 || got.Providers[0].Name != "static" || len(got.Providers[0].Teams) != 3 {
+		t.Fatalf("Wanted static provider with 3 teams got %+v", got)
+	}
+	if team := got.Providers[0].Teams[2]; team.Name != "Infra" || len(team.Repositories) != 4 || team.Projects[0] != "INF" {
+		t.Errorf("Wanted Infra with repositories and projects got %+v", team)
+	}
+}
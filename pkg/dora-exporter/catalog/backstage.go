@@ -0,0 +1,346 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+// Annotation of the component holding GitHub repository name
+const repositoryAnnotation = "github.com/project-slug"
+
+// Default annotation of the component holding Jira project key
+const defaultProjectAnnotation = "jira/project-key"
+
+const defaultRefreshInterval = 5 * time.Minute
+
+// Group type which is reported as department
+const departmentType = "department"
+
+// Maximal depth of the groups hierarchy, protects from cycles
+const maxHierarchyDepth = 16
+
+type BackstageConfig struct {
+	Endpoint string
+	// Annotation used to resolve Jira project
+	ProjectAnnotation string `yaml:"project_annotation"`
+	// Backstage static token or service-to-service bearer token
+	Token string
+	// How often the entities are fetched from Backstage
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+// BackstageCatalog resolves owners from the cached list of Backstage components,
+// the list is refreshed in background. Fallback catalog is used while Backstage is unreachable.
+type BackstageCatalog struct {
+	Endpoint          url.URL
+	ProjectAnnotation string
+	Token             string
+	RefreshInterval   time.Duration
+	Fallback          TeamsCatalog
+
+	mu sync.RWMutex
+	// owners by annotation name and lowercase annotation value
+	owners map[string]map[string]string
+	// groups by name
+	groups map[string]BackstageEntity
+	// owners with annotated repositories and projects
+	teams Teams
+	// error of the last refresh, nil when Backstage is reachable
+	err error
+
+	done    chan struct{}
+	stopped sync.Once
+}
+
+type BackstageEntity struct {
+	Kind     string
+	Metadata struct {
+		Name        string
+		Namespace   string
+		Annotations map[string]string
+	}
+	Spec struct {
+		Owner string
+		// Group only fields
+		Parent string
+		Type   string
+	}
+}
+
+// NormalizeEntityRef returns entity name from reference like group:default/payments-backend
+func NormalizeEntityRef(ref string) string {
+	if i := strings.Index(ref, ":"); i >= 0 {
+		ref = ref[i+1:]
+	}
+	if i := strings.LastIndex(ref, "/"); i >= 0 {
+		ref = ref[i+1:]
+	}
+	return ref
+}
+
+// NewCatalogFromBacktage fetches components and refreshes them in background until Stop is called
+func NewCatalogFromBacktage(conf BackstageConfig, fallback TeamsCatalog) *BackstageCatalog {
+	url, err := url.Parse(conf.Endpoint)
+	if err != nil {
+		level.Error(logger).Log(err)
+		panic(1)
+	}
+
+	if conf.ProjectAnnotation == "" {
+		conf.ProjectAnnotation = defaultProjectAnnotation
+	}
+	if conf.RefreshInterval == 0 {
+		conf.RefreshInterval = defaultRefreshInterval
+	}
+
+	var backstage = &BackstageCatalog{
+		Endpoint:          *url,
+		ProjectAnnotation: conf.ProjectAnnotation,
+		Token:             conf.Token,
+		RefreshInterval:   conf.RefreshInterval,
+		Fallback:          fallback,
+		done:              make(chan struct{}),
+	}
+	level.Info(logger).Log("catalog", "backstage", "endpoint", url.String(), "project_annotation", conf.ProjectAnnotation, "refresh_interval", conf.RefreshInterval)
+
+	_ = backstage.Refresh()
+	go backstage.refreshLoop()
+
+	return backstage
+}
+
+func (backstage *BackstageCatalog) refreshLoop() {
+	ticker := time.NewTicker(backstage.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_ = backstage.Refresh()
+		case <-backstage.done:
+			return
+		}
+	}
+}
+
+// Stop ends background refresh, cached components are still served
+func (backstage *BackstageCatalog) Stop() {
+	backstage.stopped.Do(func() { close(backstage.done) })
+}
+
+// Refresh fetches components from Backstage and rebuilds the owners index.
+// Previously fetched owners are kept when Backstage is unreachable.
+func (backstage *BackstageCatalog) Refresh() error {
+	var entities []BackstageEntity
+
+	jsonResp, err := backstage.Fetch("kind=component", "kind=group")
+	if err == nil {
+		err = json.Unmarshal(jsonResp, &entities)
+	}
+
+	backstage.mu.Lock()
+	defer backstage.mu.Unlock()
+
+	backstage.err = err
+	if err != nil {
+		level.Error(logger).Log("catalog", "backstage", "refresh", "failed", "error", err)
+		return err
+	}
+
+	owners := map[string]map[string]string{
+		repositoryAnnotation:        {},
+		backstage.ProjectAnnotation: {},
+	}
+	groups := map[string]BackstageEntity{}
+	for _, entity := range entities {
+		if strings.EqualFold(entity.Kind, "group") {
+			groups[entity.Metadata.Name] = entity
+			continue
+		}
+		if entity.Spec.Owner == "" {
+			continue
+		}
+		for annotation, index := range owners {
+			if value, ok := entity.Metadata.Annotations[annotation]; ok && value != "" {
+				index[strings.ToLower(value)] = NormalizeEntityRef(entity.Spec.Owner)
+			}
+		}
+	}
+	backstage.owners = owners
+	backstage.groups = groups
+	backstage.teams = ownerTeams(owners[repositoryAnnotation], owners[backstage.ProjectAnnotation])
+
+	level.Info(logger).Log("catalog", "backstage", "refresh", "finished", "entities", len(entities), "groups", len(groups))
+	return nil
+}
+
+// ownerTeams groups annotated repositories and projects by owner
+func ownerTeams(repositories, projects map[string]string) Teams {
+	index := map[string]*Team{}
+	team := func(name string) *Team {
+		if index[name] == nil {
+			index[name] = &Team{Name: name}
+		}
+		return index[name]
+	}
+	for repo, owner := range repositories {
+		t := team(owner)
+		t.Repositories = append(t.Repositories, repo)
+	}
+	for project, owner := range projects {
+		t := team(owner)
+		t.Projects = append(t.Projects, strings.ToUpper(project))
+	}
+
+	teams := make(Teams, 0, len(index))
+	for _, t := range index {
+		sort.Strings(t.Repositories)
+		sort.Strings(t.Projects)
+		teams = append(teams, *t)
+	}
+	sort.Slice(teams, func(i, j int) bool { return teams[i].Name < teams[j].Name })
+	return teams
+}
+
+// Teams returns owners of the cached components
+func (backstage *BackstageCatalog) Teams() Teams {
+	backstage.mu.RLock()
+	defer backstage.mu.RUnlock()
+	return backstage.teams
+}
+
+// GET :base-url/:base-path/entities?filter=kind=component
+
+func (backstage *BackstageCatalog) GetTeamNameByRepository(repository string) string {
+	owner, err := backstage.GetOwnerByAnnotation(repositoryAnnotation, repository)
+	if err != nil && backstage.Fallback != nil {
+		return backstage.Fallback.GetTeamNameByRepository(repository)
+	}
+	return owner
+}
+
+func (backstage *BackstageCatalog) GetTeamNameByProject(project string) string {
+	owner, err := backstage.GetOwnerByAnnotation(backstage.ProjectAnnotation, project)
+	if err != nil && backstage.Fallback != nil {
+		return backstage.Fallback.GetTeamNameByProject(project)
+	}
+	return owner
+}
+
+func (backstage *BackstageCatalog) ExplainRepository(repository string) Explanation {
+	return backstage.explain(repositoryAnnotation, repository, func(fallback TeamsCatalog) Explanation {
+		return ExplainRepository(fallback, repository)
+	})
+}
+
+func (backstage *BackstageCatalog) ExplainProject(project string) Explanation {
+	return backstage.explain(backstage.ProjectAnnotation, project, func(fallback TeamsCatalog) Explanation {
+		return ExplainProject(fallback, project)
+	})
+}
+
+func (backstage *BackstageCatalog) explain(annotation, value string, fallback func(TeamsCatalog) Explanation) Explanation {
+	owner, err := backstage.GetOwnerByAnnotation(annotation, value)
+	if err != nil && backstage.Fallback != nil {
+		e := fallback(backstage.Fallback)
+		e.Skipped = append([]string{"backstage: " + err.Error()}, e.Skipped...)
+		return e
+	}
+	if owner == UnknownTeam {
+		return Explanation{Team: owner}
+	}
+	return Explanation{Team: owner, Rule: "annotation", Match: annotation + ": " + value}
+}
+
+// GetOwnerByAnnotation returns owner of the component annotated with value.
+// Error is returned when owner is not cached and Backstage is unreachable.
+func (backstage *BackstageCatalog) GetOwnerByAnnotation(annotation, value string) (string, error) {
+	backstage.mu.RLock()
+	owner, ok := backstage.owners[annotation][strings.ToLower(value)]
+	err := backstage.err
+	backstage.mu.RUnlock()
+
+	if ok {
+		level.Debug(logger).Log("catalog", "owner successfully determined from backstage", "owner", owner, "annotation", annotation, "value", value)
+		return owner, nil
+	}
+
+	if err != nil {
+		level.Info(logger).Log("catalog", "backstage unreachable", "annotation", annotation, "value", value, "error", err)
+		return UnknownTeam, err
+	}
+
+	level.Info(logger).Log("catalog", "owner could not be determined from backstage", "annotation", annotation, "value", value)
+	return UnknownTeam, nil
+}
+
+// GetParentTeams walks groups hierarchy and returns direct parent of the team
+// and the closest ancestor of department type, or the root group when there is no department
+func (backstage *BackstageCatalog) GetParentTeams(team string) (parentTeam, department string) {
+	backstage.mu.RLock()
+	defer backstage.mu.RUnlock()
+
+	group, ok := backstage.groups[team]
+	for depth := 0; ok && group.Spec.Parent != "" && depth < maxHierarchyDepth; depth++ {
+		name := NormalizeEntityRef(group.Spec.Parent)
+		if parentTeam == "" {
+			parentTeam = name
+		}
+		department = name
+
+		group, ok = backstage.groups[name]
+		if ok && group.Spec.Type == departmentType {
+			break
+		}
+	}
+	return parentTeam, department
+}
+
+// Fetch queries entities matching any of the filters
+func (backstage *BackstageCatalog) Fetch(filters ...string) ([]byte, error) {
+	var uri url.URL
+	uri = backstage.Endpoint
+	uri.Path = strings.TrimSuffix(uri.Path, "/") + "/api/catalog/entities"
+	q := uri.Query()
+
+	for _, filter := range filters {
+		q.Add("filter", filter)
+	}
+	uri.RawQuery = q.Encode()
+	level.Debug(logger).Log("catalog", "query", "filter", strings.Join(filters, " or "), "uri", uri.String())
+
+	req, err := http.NewRequest(http.MethodGet, uri.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if backstage.Token != "" {
+		req.Header.Add("Authorization", "Bearer "+backstage.Token)
+	}
+
+	client := http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("backstage: %s returned %s", uri.Path, resp.Status)
+	}
+
+	return body, nil
+}
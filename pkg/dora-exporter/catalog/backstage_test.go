@@ -0,0 +1,177 @@
+package catalog_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+)
+
+func component(owner string, annotations map[string]string) map[string]interface{} {
+	return map[string]interface{}{
+		"kind":     "Component",
+		"metadata": map[string]interface{}{"annotations": annotations},
+		"spec":     map[string]string{"owner": owner},
+	}
+}
+
+func group(name, parent, groupType string) map[string]interface{} {
+	return map[string]interface{}{
+		"kind":     "Group",
+		"metadata": map[string]interface{}{"name": name},
+		"spec":     map[string]string{"parent": parent, "type": groupType},
+	}
+}
+
+// backstageServer answers components and groups query with entities, fails when unavailable is set
+func backstageServer(t *testing.T, unavailable *int32, entities ...map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(unavailable) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/catalog/entities" || strings.Join(r.URL.Query()["filter"], ",") != "kind=component,kind=group" {
+			t.Errorf("Unexpected query %s", r.URL)
+		}
+		_ = json.NewEncoder(w).Encode(entities)
+	}))
+}
+
+func TestBackstageGetTeamName(t *testing.T) {
+	catalog.SetLogger(logger)
+	var unavailable int32
+
+	server := backstageServer(t, &unavailable,
+		component("platform", map[string]string{
+			"github.com/project-slug": "mprokopov/dora-exporter",
+			"jira/project-key":        "PLATFORM",
+		}),
+		component("payments", map[string]string{"example.com/jira-project": "PAY"}),
+	)
+	defer server.Close()
+
+	service := catalog.NewCatalogFromBacktage(catalog.BackstageConfig{Endpoint: server.URL, Token: "secret"}, nil)
+	defer service.Stop()
+
+	if got := service.GetTeamNameByRepository("mprokopov/Dora-Exporter"); got != "platform" {
+		t.Errorf("Wanted platform got %s", got)
+	}
+	if got := service.GetTeamNameByProject("PLATFORM"); got != "platform" {
+		t.Errorf("Wanted platform got %s", got)
+	}
+	if got := service.GetTeamNameByProject("PAY"); got != catalog.UnknownTeam {
+		t.Errorf("Wanted %s got %s", catalog.UnknownTeam, got)
+	}
+
+	teams := service.Teams()
+	if len(teams) != 1 || teams[0].Name != "platform" || teams[0].Projects[0] != "PLATFORM" {
+		t.Errorf("Wanted platform team got %+v", teams)
+	}
+
+	custom := catalog.NewCatalogFromBacktage(catalog.BackstageConfig{Endpoint: server.URL, Token: "secret", ProjectAnnotation: "example.com/jira-project"}, nil)
+	defer custom.Stop()
+
+	if got := custom.GetTeamNameByProject("PAY"); got != "payments" {
+		t.Errorf("Wanted payments got %s", got)
+	}
+}
+
+func TestBackstageFallback(t *testing.T) {
+	catalog.SetLogger(logger)
+	unavailable := int32(1)
+
+	server := backstageServer(t, &unavailable,
+		component("platform", map[string]string{"github.com/project-slug": "mprokopov/provisioner"}),
+	)
+	defer server.Close()
+
+	service := catalog.NewCatalogFromBacktage(catalog.BackstageConfig{Endpoint: server.URL, Token: "secret"}, SetupCatalog())
+	defer service.Stop()
+
+	// static teams are used while backstage is unreachable
+	if got := service.GetTeamNameByRepository("mprokopov/provisioner"); got != "Infra" {
+		t.Errorf("Wanted Infra got %s", got)
+	}
+	if got := service.GetTeamNameByProject("PAY"); got != "Payments" {
+		t.Errorf("Wanted Payments got %s", got)
+	}
+
+	explanation := catalog.ExplainRepository(service, "mprokopov/provisioner")
+	if explanation.Team != "Infra" || explanation.Rule != "exact" || len(explanation.Skipped) != 1 {
+		t.Errorf("Wanted static fallback explanation got %+v", explanation)
+	}
+
+	atomic.StoreInt32(&unavailable, 0)
+	if err := service.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got := service.GetTeamNameByRepository("mprokopov/provisioner"); got != "platform" {
+		t.Errorf("Wanted platform got %s", got)
+	}
+
+	// cached owners are kept when refresh fails
+	atomic.StoreInt32(&unavailable, 1)
+	if err := service.Refresh(); err == nil {
+		t.Error("Wanted refresh error")
+	}
+	if got := service.GetTeamNameByRepository("mprokopov/provisioner"); got != "platform" {
+		t.Errorf("Wanted cached platform got %s", got)
+	}
+}
+
+func TestBackstageHierarchy(t *testing.T) {
+	catalog.SetLogger(logger)
+	var unavailable int32
+
+	server := backstageServer(t, &unavailable,
+		component("group:default/payments-backend", map[string]string{"github.com/project-slug": "acme/billing"}),
+		group("payments-backend", "group:default/payments", "team"),
+		group("payments", "finance", "team"),
+		group("finance", "group:default/acme", "department"),
+		group("acme", "", "organization"),
+		group("platform", "group:default/acme", "team"),
+		// cycle must not hang the lookup
+		group("loop-a", "loop-b", "team"),
+		group("loop-b", "loop-a", "team"),
+	)
+	defer server.Close()
+
+	service := catalog.NewCatalogFromBacktage(catalog.BackstageConfig{Endpoint: server.URL, Token: "secret"}, nil)
+	defer service.Stop()
+
+	team := service.GetTeamNameByRepository("acme/billing")
+	if team != "payments-backend" {
+		t.Fatalf("Wanted normalized payments-backend got %s", team)
+	}
+
+	tests := []struct {
+		team, parent, department string
+	}{
+		{"payments-backend", "payments", "finance"},
+		{"payments", "finance", "finance"},
+		{"finance", "acme", "acme"},
+		{"platform", "acme", "acme"},
+		{"acme", "", ""},
+		{"missing", "", ""},
+		{"loop-a", "loop-b", "loop-a"},
+	}
+	for _, test := range tests {
+		parent, department := catalog.GetParentTeams(service, test.team)
+		if parent != test.parent || department != test.department {
+			t.Errorf("%s: wanted %s/%s got %s/%s", test.team, test.parent, test.department, parent, department)
+		}
+	}
+
+	// static catalog has no hierarchy
+	if parent, department := catalog.GetParentTeams(SetupCatalog(), "Payments"); parent != "" || department != "" {
+		t.Errorf("Wanted empty hierarchy got %s/%s", parent, department)
+	}
+}
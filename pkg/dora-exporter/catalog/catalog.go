@@ -1,14 +1,6 @@
 package catalog
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/url"
-
-	"net/http"
-	"time"
-
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"gopkg.in/yaml.v3"
@@ -21,14 +13,48 @@ func SetLogger(log log.Logger) {
 	return
 }
 
+// UnknownTeam is returned when owner of repository or project can't be determined
+const UnknownTeam = "Unknown"
+
 type Team struct {
-	Name         string
-	Repositories []string `yaml:"github_repositories"`
-	Projects     []string `yaml:"jira_projects"`
+	Name         string   `json:"name"`
+	Repositories []string `yaml:"github_repositories" json:"github_repositories"`
+	Projects     []string `yaml:"jira_projects" json:"jira_projects"`
+	// Repositories matched by patterns which don't belong to the team
+	ExcludeRepositories []string `yaml:"exclude_repositories,omitempty" json:"exclude_repositories,omitempty"`
+	// Services of incident management tools like PagerDuty or Opsgenie
+	Services []string `yaml:"services,omitempty" json:"services,omitempty"`
 }
 
 type Teams []Team
 
+// Hierarchy is implemented by catalogs aware of parent teams
+type Hierarchy interface {
+	GetParentTeams(team string) (parentTeam, department string)
+}
+
+// GetParentTeams returns parent team and department of the team, empty when catalog has no hierarchy
+func GetParentTeams(catalog TeamsCatalog, team string) (parentTeam, department string) {
+	if hierarchy, ok := catalog.(Hierarchy); ok {
+		return hierarchy.GetParentTeams(team)
+	}
+	return "", ""
+}
+
+// ServiceCatalog is implemented by catalogs aware of incident management services
+type ServiceCatalog interface {
+	GetTeamNameByService(service string) string
+}
+
+// GetTeamNameByService returns owner of the incident service,
+// catalogs without services resolve it as a project
+func GetTeamNameByService(catalog TeamsCatalog, service string) string {
+	if services, ok := catalog.(ServiceCatalog); ok {
+		return services.GetTeamNameByService(service)
+	}
+	return catalog.GetTeamNameByProject(service)
+}
+
 type TeamsCatalog interface {
 	// Fetch team name by repository name
 	GetTeamNameByRepository(repo string) string
@@ -36,39 +62,31 @@ type TeamsCatalog interface {
 	GetTeamNameByProject(project string) string
 }
 
-type BackstageCatalog struct {
-	Endpoint url.URL
+// GetTeamNameByRepository indexes teams on every call, use NewStaticCatalog for repeated lookups
+func (teams Teams) GetTeamNameByRepository(repository string) string {
+	return teams.resolve(func(c *StaticCatalog) string { return c.GetTeamNameByRepository(repository) })
 }
 
-type BackstageResponse struct {
-	Spec struct {
-		Owner string
-	}
+// GetTeamNameByProject returns team name from catalog query
+func (teams Teams) GetTeamNameByProject(project string) string {
+	return teams.resolve(func(c *StaticCatalog) string { return c.GetTeamNameByProject(project) })
 }
 
-func (teams Teams) GetTeamNameByRepository(repository string) string {
-	for _, team := range teams {
-		for _, repo := range team.Repositories {
-			if repo == repository {
-				return team.Name
-			}
-		}
-	}
-	return "Unknown"
+// GetTeamNameByService returns team listing the service, falls back to project with the same name
+func (teams Teams) GetTeamNameByService(service string) string {
+	return teams.resolve(func(c *StaticCatalog) string { return c.GetTeamNameByService(service) })
 }
 
-// GetTeamNameByProject returns team name from catalog query
-func (teams Teams) GetTeamNameByProject(project string) string {
-	for _, team := range teams {
-		for _, teamProject := range team.Projects {
-			if project == teamProject {
-				return team.Name
-			}
-		}
+func (teams Teams) resolve(lookup func(c *StaticCatalog) string) string {
+	c, err := NewStaticCatalog(teams)
+	if err != nil {
+		level.Error(logger).Log("catalog", "static", "error", err)
+		return UnknownTeam
 	}
-	return "Unknown"
+	return lookup(c)
 }
 
+// NewCatalogFromYaml indexes teams once, lookups are served by the static catalog
 func NewCatalogFromYaml(yamlString string) TeamsCatalog {
 	var teams Teams
 	err := yaml.Unmarshal([]byte(yamlString), &teams)
@@ -76,73 +94,11 @@ func NewCatalogFromYaml(yamlString string) TeamsCatalog {
 		level.Error(logger).Log(err)
 		panic(1)
 	}
-	level.Info(logger).Log("catalog", "static", "teams", len(teams))
-	return teams
-}
-
-func NewCatalogFromBacktage(backstageUrl string) TeamsCatalog {
-	url, err := url.Parse(backstageUrl)
+	c, err := NewStaticCatalog(teams)
 	if err != nil {
 		level.Error(logger).Log(err)
 		panic(1)
 	}
-
-	var backstage = BackstageCatalog{Endpoint: *url}
-	level.Info(logger).Log("catalog", "backstage", "endpoint", url.String())
-	return backstage
-}
-
-// GET :base-url/:base-path/entities?filter=metadata.annotations.github.com/project-slug=mprokopov/dora-exporter
-
-func (backstage BackstageCatalog) GetTeamNameByRepository(repository string) string {
-	var filter string
-	var backstageResults []BackstageResponse
-	filter = fmt.Sprintf("metadata.annotations.github.com/project-slug=%s", repository)
-
-	jsonResp, _ := backstage.Fetch(filter)
-
-	err := json.Unmarshal(jsonResp, &backstageResults)
-
-	if err != nil {
-		level.Error(logger).Log("catalog", err)
-	}
-
-	if len(backstageResults) == 0 || backstageResults[0].Spec.Owner == "" {
-		level.Info(logger).Log("catalog", "owner could not be determined from backstage", "repository", repository)
-		return "Unknown"
-	}
-
-	level.Info(logger).Log("catalog", "owner successfully determined from backstage", "owner", backstageResults[0].Spec.Owner, "repository", repository)
-
-	return backstageResults[0].Spec.Owner
-}
-
-func (backstage BackstageCatalog) GetTeamNameByProject(project string) string {
-	level.Info(logger).Log("catalog", "query backstage team name by project", "repository", project)
-	return "Unknown"
-}
-
-func (backstage BackstageCatalog) Fetch(filter string) ([]byte, error) {
-	var uri url.URL
-	uri = backstage.Endpoint
-	uri.Path = "/api/catalog/entities"
-	q := uri.Query()
-
-	q.Add("filter", filter)
-	uri.RawQuery = q.Encode()
-	level.Info(logger).Log("catalog", "query", "filter", filter, "uri", uri.String())
-
-	req, err := http.NewRequest(http.MethodGet, uri.String(), http.NoBody)
-	if err != nil {
-		level.Error(logger).Log("catalog", err)
-	}
-
-	client := http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		level.Error(logger).Log("catalog", err)
-	}
-	defer resp.Body.Close()
-
-	return io.ReadAll(resp.Body)
+	level.Info(logger).Log("catalog", "static", "teams", len(teams), "patterns", len(c.patterns))
+	return c
 }
@@ -81,3 +81,24 @@ func Example_basic() {
 	// Infra
 	// Payments
 }
+
+func TestTeamsLookup(t *testing.T) {
+	catalog.SetLogger(logger)
+	teams := catalog.Teams{
+		{Name: "Payments", Repositories: []string{"mprokopov/pay-*"}, Projects: []string{"PAY"}, Services: []string{"Checkout"}},
+		{Name: "Infra", Repositories: []string{"mprokopov/provisioner"}, Projects: []string{"INF"}},
+	}
+
+	if got := teams.GetTeamNameByRepository("mprokopov/pay-api"); got != "Payments" {
+		t.Errorf("Wanted Payments got %s", got)
+	}
+	if got := teams.GetTeamNameByProject("INF"); got != "Infra" {
+		t.Errorf("Wanted Infra got %s", got)
+	}
+	if got := teams.GetTeamNameByService("checkout"); got != "Payments" {
+		t.Errorf("Wanted Payments got %s", got)
+	}
+	if got := teams.GetTeamNameByService("unknown"); got != catalog.UnknownTeam {
+		t.Errorf("Wanted %s got %s", catalog.UnknownTeam, got)
+	}
+}
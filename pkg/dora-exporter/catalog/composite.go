@@ -0,0 +1,175 @@
+package catalog
+
+import (
+	"fmt"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Provider is a catalog named in configuration
+type Provider struct {
+	Name    string
+	Catalog TeamsCatalog
+}
+
+// Composite resolves owners using providers in order, the first provider knowing the team answers.
+// Lookups are counted per provider as hits and misses.
+type Composite struct {
+	Providers []Provider
+	lookups   *prometheus.CounterVec
+}
+
+func NewComposite(providers ...Provider) *Composite {
+	names := make([]string, 0, len(providers))
+	for _, p := range providers {
+		names = append(names, p.Name)
+	}
+	level.Info(logger).Log("catalog", "composite", "providers", fmt.Sprint(names))
+
+	return &Composite{
+		Providers: providers,
+		lookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "dora",
+			Name:      "catalog_lookups_total",
+			Help:      "The amount of team lookups by catalog provider, kind and result.",
+		}, []string{"provider", "kind", "result"}),
+	}
+}
+
+// ResolveRepository returns owner of the repository and name of the provider which answered,
+// provider is empty when the team is unknown
+func (c *Composite) ResolveRepository(repository string) (team, provider string) {
+	return c.resolve("repository", repository, func(catalog TeamsCatalog) string {
+		return catalog.GetTeamNameByRepository(repository)
+	})
+}
+
+// ResolveProject returns owner of the project and name of the provider which answered
+func (c *Composite) ResolveProject(project string) (team, provider string) {
+	return c.resolve("project", project, func(catalog TeamsCatalog) string {
+		return catalog.GetTeamNameByProject(project)
+	})
+}
+
+// ResolveService returns owner of the incident service and name of the provider which answered
+func (c *Composite) ResolveService(service string) (team, provider string) {
+	return c.resolve("service", service, func(catalog TeamsCatalog) string {
+		return GetTeamNameByService(catalog, service)
+	})
+}
+
+func (c *Composite) resolve(kind, value string, lookup func(TeamsCatalog) string) (string, string) {
+	for _, p := range c.Providers {
+		team := lookup(p.Catalog)
+		if team == UnknownTeam {
+			c.lookups.WithLabelValues(p.Name, kind, "miss").Inc()
+			continue
+		}
+		c.lookups.WithLabelValues(p.Name, kind, "hit").Inc()
+		level.Debug(logger).Log("catalog", "composite", kind, value, "provider", p.Name, "team", team)
+		return team, p.Name
+	}
+	return UnknownTeam, ""
+}
+
+// Resolver is implemented by catalogs made of several providers, it tells which provider answered
+type Resolver interface {
+	ResolveRepository(repository string) (team, provider string)
+	ResolveProject(project string) (team, provider string)
+	ResolveService(service string) (team, provider string)
+}
+
+// ResolveRepository returns owner of the repository and provider which answered,
+// provider is empty for catalogs which aren't made of providers
+func ResolveRepository(catalog TeamsCatalog, repository string) (team, provider string) {
+	if resolver, ok := catalog.(Resolver); ok {
+		return resolver.ResolveRepository(repository)
+	}
+	return catalog.GetTeamNameByRepository(repository), ""
+}
+
+// ResolveProject returns owner of the project and provider which answered
+func ResolveProject(catalog TeamsCatalog, project string) (team, provider string) {
+	if resolver, ok := catalog.(Resolver); ok {
+		return resolver.ResolveProject(project)
+	}
+	return catalog.GetTeamNameByProject(project), ""
+}
+
+// ResolveService returns owner of the incident service and provider which answered
+func ResolveService(catalog TeamsCatalog, service string) (team, provider string) {
+	if resolver, ok := catalog.(Resolver); ok {
+		return resolver.ResolveService(service)
+	}
+	return GetTeamNameByService(catalog, service), ""
+}
+
+func (c *Composite) GetTeamNameByRepository(repository string) string {
+	team, _ := c.ResolveRepository(repository)
+	return team
+}
+
+func (c *Composite) GetTeamNameByProject(project string) string {
+	team, _ := c.ResolveProject(project)
+	return team
+}
+
+func (c *Composite) GetTeamNameByService(service string) string {
+	team, _ := c.ResolveService(service)
+	return team
+}
+
+// GetParentTeams returns hierarchy from the first provider which knows parents of the team
+func (c *Composite) GetParentTeams(team string) (parentTeam, department string) {
+	for _, p := range c.Providers {
+		if parentTeam, department = GetParentTeams(p.Catalog, team); parentTeam != "" || department != "" {
+			return parentTeam, department
+		}
+	}
+	return "", ""
+}
+
+// Lookups returns counter of lookups by provider, kind and result
+func (c *Composite) Lookups() *prometheus.CounterVec {
+	return c.lookups
+}
+
+func (c *Composite) Describe(ch chan<- *prometheus.Desc) {
+	c.lookups.Describe(ch)
+}
+
+func (c *Composite) Collect(ch chan<- prometheus.Metric) {
+	c.lookups.Collect(ch)
+}
+
+func (c *Composite) ExplainRepository(repository string) Explanation {
+	return c.explain(func(catalog TeamsCatalog) Explanation {
+		return ExplainRepository(catalog, repository)
+	})
+}
+
+func (c *Composite) ExplainProject(project string) Explanation {
+	return c.explain(func(catalog TeamsCatalog) Explanation {
+		return ExplainProject(catalog, project)
+	})
+}
+
+// explain asks providers in order without counting lookups, skipped rules are prefixed with provider name
+func (c *Composite) explain(explain func(TeamsCatalog) Explanation) Explanation {
+	var skipped []string
+	for _, p := range c.Providers {
+		e := explain(p.Catalog)
+		for _, s := range e.Skipped {
+			skipped = append(skipped, p.Name+": "+s)
+		}
+		if e.Team == UnknownTeam {
+			skipped = append(skipped, p.Name+": no match")
+			continue
+		}
+		e.Provider = p.Name
+		e.Skipped = skipped
+		return e
+	}
+	return Explanation{Team: UnknownTeam, Skipped: skipped}
+}
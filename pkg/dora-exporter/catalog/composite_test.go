@@ -0,0 +1,54 @@
+package catalog_test
+
+import (
+	"testing"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestComposite(t *testing.T) {
+	catalog.SetLogger(logger)
+	overrides := catalog.NewCatalogFromYaml(`
+- name: Override
+  github_repositories:
+    - mprokopov/alfred
+`)
+	composite := catalog.NewComposite(
+		catalog.Provider{Name: "overrides", Catalog: overrides},
+		catalog.Provider{Name: "static", Catalog: SetupCatalog()},
+	)
+
+	examples := []struct {
+		repo, team, provider string
+	}{
+		{"mprokopov/alfred", "Override", "overrides"},
+		{"mprokopov/provisioner", "Infra", "static"},
+		{"not_found", catalog.UnknownTeam, ""},
+	}
+	for _, example := range examples {
+		team, provider := composite.ResolveRepository(example.repo)
+		if team != example.team || provider != example.provider {
+			t.Errorf("%s: wanted %s from %s got %s from %s", example.repo, example.team, example.provider, team, provider)
+		}
+	}
+
+	if team, provider := composite.ResolveProject("PAY"); team != "Payments" || provider != "static" {
+		t.Errorf("Wanted Payments from static got %s from %s", team, provider)
+	}
+	if team, provider := catalog.ResolveRepository(composite, "mprokopov/alfred"); team != "Override" || provider != "overrides" {
+		t.Errorf("Wanted Override from overrides got %s from %s", team, provider)
+	}
+	// catalogs which aren't made of providers don't name one
+	if team, provider := catalog.ResolveRepository(overrides, "mprokopov/alfred"); team != "Override" || provider != "" {
+		t.Errorf("Wanted Override without provider got %s from %s", team, provider)
+	}
+
+	// hits and misses of repositories and projects, static provider never missed a project
+	if got := testutil.CollectAndCount(composite); got != 6 {
+		t.Errorf("Wanted 6 series got %d", got)
+	}
+	if got := testutil.ToFloat64(composite.Lookups().WithLabelValues("overrides", "repository", "miss")); got != 2 {
+		t.Errorf("Wanted 2 overrides misses got %v", got)
+	}
+}
@@ -0,0 +1,48 @@
+package catalog
+
+// Explanation describes how the owner of repository or project was resolved
+type Explanation struct {
+	Team string `json:"team"`
+	// Name of the composite catalog provider which answered
+	Provider string `json:"provider,omitempty"`
+	// exact, pattern, project, annotation or lookup for catalogs unable to explain
+	Rule string `json:"rule,omitempty"`
+	// Repository pattern, project key or annotation which matched
+	Match string `json:"match,omitempty"`
+	// Rules and providers which were tried without success
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// Explainer is implemented by catalogs able to explain how the owner was resolved
+type Explainer interface {
+	ExplainRepository(repository string) Explanation
+	ExplainProject(project string) Explanation
+}
+
+// Lister is implemented by catalogs knowing all their teams
+type Lister interface {
+	Teams() Teams
+}
+
+// ExplainRepository explains owner of the repository, catalogs not implementing Explainer are only asked for the team
+func ExplainRepository(catalog TeamsCatalog, repository string) Explanation {
+	if explainer, ok := catalog.(Explainer); ok {
+		return explainer.ExplainRepository(repository)
+	}
+	return lookupExplanation(catalog.GetTeamNameByRepository(repository))
+}
+
+// ExplainProject explains owner of the project
+func ExplainProject(catalog TeamsCatalog, project string) Explanation {
+	if explainer, ok := catalog.(Explainer); ok {
+		return explainer.ExplainProject(project)
+	}
+	return lookupExplanation(catalog.GetTeamNameByProject(project))
+}
+
+func lookupExplanation(team string) Explanation {
+	if team == UnknownTeam {
+		return Explanation{Team: team}
+	}
+	return Explanation{Team: team, Rule: "lookup"}
+}
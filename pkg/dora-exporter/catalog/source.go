@@ -0,0 +1,241 @@
+package catalog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"gopkg.in/yaml.v3"
+)
+
+// SourceCatalog is a static catalog loaded from a YAML or JSON file or HTTP(S) URL
+// and reloaded in background. Previous teams are kept when reload or validation fails.
+type SourceCatalog struct {
+	Source          string
+	Token           string
+	RefreshInterval time.Duration
+
+	mu      sync.RWMutex
+	current *StaticCatalog
+
+	done    chan struct{}
+	stopped sync.Once
+}
+
+// NewCatalogFromSource loads teams from source and reloads them in background until Stop is called,
+// error is returned when initial load fails
+func NewCatalogFromSource(source, token string, refreshInterval time.Duration) (*SourceCatalog, error) {
+	if refreshInterval == 0 {
+		refreshInterval = defaultRefreshInterval
+	}
+	c := &SourceCatalog{Source: source, Token: token, RefreshInterval: refreshInterval, done: make(chan struct{})}
+
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	go c.refreshLoop()
+
+	return c, nil
+}
+
+func (c *SourceCatalog) refreshLoop() {
+	ticker := time.NewTicker(c.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_ = c.Reload()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Stop ends background reload, the last loaded teams are still served
+func (c *SourceCatalog) Stop() {
+	c.stopped.Do(func() { close(c.done) })
+}
+
+// Reload reads and validates teams, the catalog is replaced only when they are valid
+func (c *SourceCatalog) Reload() error {
+	static, err := c.load()
+	if err != nil {
+		level.Error(logger).Log("catalog", "source", "source", c.Source, "error", err)
+		return err
+	}
+
+	c.mu.Lock()
+	c.current = static
+	c.mu.Unlock()
+
+	level.Info(logger).Log("catalog", "source", "source", c.Source, "teams", len(static.Teams()))
+	return nil
+}
+
+func (c *SourceCatalog) load() (*StaticCatalog, error) {
+	data, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	teams, err := ParseTeams(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewStaticCatalog(teams)
+}
+
+func (c *SourceCatalog) read() ([]byte, error) {
+	if !strings.HasPrefix(c.Source, "http://") && !strings.HasPrefix(c.Source, "https://") {
+		return ioutil.ReadFile(c.Source)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.Source, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Add("Authorization", "Bearer "+c.Token)
+	}
+
+	client := http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("catalog: %s returned %s", c.Source, resp.Status)
+	}
+	return body, nil
+}
+
+// ParseTeams decodes and validates teams from YAML or JSON, either a list of teams
+// or an object with teams key. Unknown fields are rejected to catch typos.
+func ParseTeams(data []byte) (Teams, error) {
+	var teams Teams
+
+	// JSON is a subset of YAML, both are decoded the same way
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("catalog: %w", err)
+	}
+
+	var err error
+	if len(document.Content) > 0 && document.Content[0].Kind == yaml.MappingNode {
+		var wrapped struct {
+			Teams Teams
+		}
+		err = decodeStrict(data, &wrapped)
+		teams = wrapped.Teams
+	} else {
+		err = decodeStrict(data, &teams)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("catalog: %w", err)
+	}
+
+	if err = ValidateTeams(teams); err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	return decoder.Decode(v)
+}
+
+// ValidateTeams checks that teams are named uniquely and repositories, projects and services belong to a single team
+func ValidateTeams(teams Teams) error {
+	if len(teams) == 0 {
+		return errors.New("catalog: no teams")
+	}
+
+	names := map[string]bool{}
+	repositories := map[string]string{}
+	projects := map[string]string{}
+	services := map[string]string{}
+
+	for i, team := range teams {
+		if team.Name == "" {
+			return fmt.Errorf("catalog: team #%d has no name", i+1)
+		}
+		if names[team.Name] {
+			return fmt.Errorf("catalog: team %s is duplicated", team.Name)
+		}
+		names[team.Name] = true
+
+		for _, repo := range team.Repositories {
+			if repo == "" {
+				return fmt.Errorf("catalog: team %s has empty repository", team.Name)
+			}
+			key := strings.ToLower(repo)
+			if owner, ok := repositories[key]; ok {
+				return fmt.Errorf("catalog: repository %s belongs to %s and %s", repo, owner, team.Name)
+			}
+			repositories[key] = team.Name
+		}
+		for _, project := range team.Projects {
+			if project == "" {
+				return fmt.Errorf("catalog: team %s has empty project", team.Name)
+			}
+			if owner, ok := projects[project]; ok {
+				return fmt.Errorf("catalog: project %s belongs to %s and %s", project, owner, team.Name)
+			}
+			projects[project] = team.Name
+		}
+		for _, service := range team.Services {
+			key := strings.ToLower(service)
+			if owner, ok := services[key]; ok {
+				return fmt.Errorf("catalog: service %s belongs to %s and %s", service, owner, team.Name)
+			}
+			services[key] = team.Name
+		}
+	}
+	return nil
+}
+
+func (c *SourceCatalog) catalog() *StaticCatalog {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.current
+}
+
+// Teams returns currently loaded teams
+func (c *SourceCatalog) Teams() Teams {
+	return c.catalog().Teams()
+}
+
+func (c *SourceCatalog) GetTeamNameByRepository(repository string) string {
+	return c.catalog().GetTeamNameByRepository(repository)
+}
+
+func (c *SourceCatalog) GetTeamNameByProject(project string) string {
+	return c.catalog().GetTeamNameByProject(project)
+}
+
+func (c *SourceCatalog) GetTeamNameByService(service string) string {
+	return c.catalog().GetTeamNameByService(service)
+}
+
+func (c *SourceCatalog) ExplainRepository(repository string) Explanation {
+	return c.catalog().ExplainRepository(repository)
+}
+
+func (c *SourceCatalog) ExplainProject(project string) Explanation {
+	return c.catalog().ExplainProject(project)
+}
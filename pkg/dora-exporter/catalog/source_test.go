@@ -0,0 +1,153 @@
+package catalog_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+)
+
+func TestParseTeams(t *testing.T) {
+	examples := map[string]string{
+		"yaml list":   example,
+		"yaml object": "teams:\n  - name: Infra\n    github_repositories: [mprokopov/provisioner]\n",
+		"json list":   `[{"name": "Infra", "github_repositories": ["mprokopov/provisioner"], "jira_projects": ["INF"]}]`,
+		"json object": `{"teams": [{"name": "Infra", "github_repositories": ["mprokopov/provisioner"]}]}`,
+	}
+	for name, data := range examples {
+		teams, err := catalog.ParseTeams([]byte(data))
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		service, err := catalog.NewStaticCatalog(teams)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if service.GetTeamNameByRepository("mprokopov/provisioner") != "Infra" {
+			t.Errorf("%s: wanted Infra in %v", name, teams)
+		}
+	}
+}
+
+func TestParseTeamsInvalid(t *testing.T) {
+	examples := map[string]string{
+		"empty":           "",
+		"unknown field":   "- name: Infra\n  github_repos: [mprokopov/provisioner]\n",
+		"no name":         "- github_repositories: [mprokopov/provisioner]\n",
+		"duplicated team": "- name: Infra\n- name: Infra\n",
+		"shared repo":     "- name: Infra\n  github_repositories: [acme/a]\n- name: Risk\n  github_repositories: [ACME/A]\n",
+		"shared project":  "- name: Infra\n  jira_projects: [INF]\n- name: Risk\n  jira_projects: [INF]\n",
+		"invalid json":    `[{"name": "Infra"`,
+	}
+	for name, data := range examples {
+		if _, err := catalog.ParseTeams([]byte(data)); err == nil {
+			t.Errorf("%s: wanted error", name)
+		}
+	}
+}
+
+func TestSourceCatalogFile(t *testing.T) {
+	catalog.SetLogger(logger)
+	path := filepath.Join(t.TempDir(), "teams.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "Infra", "jira_projects": ["INF"]}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := catalog.NewCatalogFromSource(path, "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Stop()
+	if got := service.GetTeamNameByProject("INF"); got != "Infra" {
+		t.Errorf("Wanted Infra got %s", got)
+	}
+
+	// invalid file keeps previous teams
+	if err = os.WriteFile(path, []byte(`[{"name": ""}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err = service.Reload(); err == nil {
+		t.Error("Wanted reload error")
+	}
+	if got := service.GetTeamNameByProject("INF"); got != "Infra" {
+		t.Errorf("Wanted previous Infra got %s", got)
+	}
+
+	if _, err = catalog.NewCatalogFromSource(filepath.Join(t.TempDir(), "missing.yml"), "", time.Hour); err == nil {
+		t.Error("Wanted error for missing file")
+	}
+}
+
+func TestSourceCatalogURL(t *testing.T) {
+	catalog.SetLogger(logger)
+	var version int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		team := "Infra"
+		if atomic.LoadInt32(&version) > 0 {
+			team = "Platform"
+		}
+		_, _ = w.Write([]byte(strings.Replace("- name: TEAM\n  github_repositories: [acme/*]\n", "TEAM", team, 1)))
+	}))
+	defer server.Close()
+
+	service, err := catalog.NewCatalogFromSource(server.URL+"/teams.yml", "secret", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Stop()
+	if got := service.GetTeamNameByRepository("acme/api"); got != "Infra" {
+		t.Errorf("Wanted Infra got %s", got)
+	}
+
+	atomic.StoreInt32(&version, 1)
+	if err = service.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := service.GetTeamNameByRepository("acme/api"); got != "Platform" {
+		t.Errorf("Wanted Platform got %s", got)
+	}
+}
+
+func TestSourceCatalogStop(t *testing.T) {
+	catalog.SetLogger(logger)
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write([]byte("- name: Infra\n  jira_projects: [INF]\n"))
+	}))
+	defer server.Close()
+
+	service, err := catalog.NewCatalogFromSource(server.URL, "", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	service.Stop()
+	service.Stop()
+
+	stopped := atomic.LoadInt32(&requests)
+	if stopped < 2 {
+		t.Errorf("Wanted background reloads got %d requests", stopped)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&requests); got > stopped+1 {
+		t.Errorf("Wanted no reloads after stop got %d more requests", got-stopped)
+	}
+	if got := service.GetTeamNameByProject("INF"); got != "Infra" {
+		t.Errorf("Wanted Infra after stop got %s", got)
+	}
+}
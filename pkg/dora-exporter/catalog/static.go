@@ -0,0 +1,246 @@
+package catalog
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log/level"
+)
+
+// Maximal amount of cached repository lookups, cache is reset when exceeded
+const maxCachedRepositories = 10000
+
+// repositoryPattern is a glob like org/payments-* or a regular expression enclosed in slashes like /^org\/pay.*$/,
+// both match the whole repository name
+type repositoryPattern struct {
+	team    string
+	pattern string
+	// length of the literal prefix, longer prefix is more specific
+	prefix int
+	regexp *regexp.Regexp
+}
+
+// before reports whether the pattern is tried before other: longer literal prefix first,
+// regular expressions before globs with the same prefix, as they usually carve out
+// a part of repositories matched by the glob
+func (p repositoryPattern) before(other repositoryPattern) bool {
+	if p.prefix != other.prefix {
+		return p.prefix > other.prefix
+	}
+	return p.regexp != nil && other.regexp == nil
+}
+
+// isPattern reports whether repository entry is a glob or regular expression
+func isPattern(entry string) bool {
+	return isRegexp(entry) || strings.ContainsAny(entry, "*?[")
+}
+
+func isRegexp(entry string) bool {
+	return len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/")
+}
+
+func newRepositoryPattern(team, entry string) (repositoryPattern, error) {
+	p := repositoryPattern{team: team, pattern: entry}
+
+	if isRegexp(entry) {
+		expr := entry[1 : len(entry)-1]
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return p, fmt.Errorf("catalog: team %s: invalid regexp %s: %w", team, entry, err)
+		}
+		p.prefix = len(regexpPrefix(expr))
+		// repository names are case insensitive, the whole name is matched like globs do
+		p.regexp = regexp.MustCompile("(?i)^(?:" + re.String() + ")$")
+		return p, nil
+	}
+
+	p.pattern = strings.ToLower(entry)
+	if _, err := path.Match(p.pattern, ""); err != nil {
+		return p, fmt.Errorf("catalog: team %s: invalid pattern %s: %w", team, entry, err)
+	}
+	p.prefix = strings.IndexAny(p.pattern, "*?[")
+	if p.prefix < 0 {
+		p.prefix = len(p.pattern)
+	}
+	return p, nil
+}
+
+// regexpPrefix returns literal text of the expression before its first special character,
+// regexp.LiteralPrefix is empty for most of the expressions anchored with ^
+func regexpPrefix(expr string) string {
+	expr = strings.TrimPrefix(expr, "^")
+	i := strings.IndexAny(expr, `\.+*?()|[]{}^$`)
+	if i < 0 {
+		return expr
+	}
+	// quantifier makes the preceding character optional
+	if i > 0 && strings.ContainsAny(expr[i:i+1], "*?{") {
+		i--
+	}
+	return expr[:i]
+}
+
+// match reports whether lowercase repository matches the pattern
+func (p repositoryPattern) match(repository string) bool {
+	if p.regexp != nil {
+		return p.regexp.MatchString(repository)
+	}
+	ok, _ := path.Match(p.pattern, repository)
+	return ok
+}
+
+// StaticCatalog is indexed catalog of the teams from configuration.
+// Repositories are resolved in order of precedence: exact name, pattern with
+// the longest literal prefix, regular expression before glob, order of the teams in the file.
+// Repositories matching team exclusions are never resolved to the team by its patterns.
+type StaticCatalog struct {
+	teams Teams
+	// team by lowercase repository name
+	repositories map[string]string
+	// patterns ordered by precedence
+	patterns   []repositoryPattern
+	exclusions map[string][]repositoryPattern
+	projects   map[string]string
+	// team by lowercase service name
+	services map[string]string
+
+	mu    sync.RWMutex
+	cache map[string]string
+}
+
+// NewStaticCatalog indexes teams, returns error when pattern is invalid
+func NewStaticCatalog(teams Teams) (*StaticCatalog, error) {
+	c := &StaticCatalog{
+		teams:        teams,
+		repositories: map[string]string{},
+		exclusions:   map[string][]repositoryPattern{},
+		projects:     map[string]string{},
+		services:     map[string]string{},
+		cache:        map[string]string{},
+	}
+
+	for _, team := range teams {
+		for _, repo := range team.Repositories {
+			if !isPattern(repo) {
+				// the first team listing repository owns it
+				if _, ok := c.repositories[strings.ToLower(repo)]; !ok {
+					c.repositories[strings.ToLower(repo)] = team.Name
+				}
+				continue
+			}
+			p, err := newRepositoryPattern(team.Name, repo)
+			if err != nil {
+				return nil, err
+			}
+			c.patterns = append(c.patterns, p)
+		}
+
+		for _, repo := range team.ExcludeRepositories {
+			p, err := newRepositoryPattern(team.Name, repo)
+			if err != nil {
+				return nil, err
+			}
+			c.exclusions[team.Name] = append(c.exclusions[team.Name], p)
+		}
+
+		for _, project := range team.Projects {
+			if _, ok := c.projects[project]; !ok {
+				c.projects[project] = team.Name
+			}
+		}
+
+		for _, service := range team.Services {
+			if _, ok := c.services[strings.ToLower(service)]; !ok {
+				c.services[strings.ToLower(service)] = team.Name
+			}
+		}
+	}
+
+	// stable sort keeps the order of the file for equally specific patterns
+	sort.SliceStable(c.patterns, func(i, j int) bool { return c.patterns[i].before(c.patterns[j]) })
+
+	return c, nil
+}
+
+// Teams returns teams the catalog was created from
+func (c *StaticCatalog) Teams() Teams {
+	return c.teams
+}
+
+func (c *StaticCatalog) GetTeamNameByRepository(repository string) string {
+	repository = strings.ToLower(repository)
+
+	c.mu.RLock()
+	team, ok := c.cache[repository]
+	c.mu.RUnlock()
+	if ok {
+		return team
+	}
+
+	team = c.ExplainRepository(repository).Team
+
+	c.mu.Lock()
+	if len(c.cache) >= maxCachedRepositories {
+		c.cache = map[string]string{}
+	}
+	c.cache[repository] = team
+	c.mu.Unlock()
+
+	return team
+}
+
+// ExplainRepository returns the rule resolving owner of the repository along with patterns skipped by exclusions
+func (c *StaticCatalog) ExplainRepository(repository string) Explanation {
+	repository = strings.ToLower(repository)
+
+	if team, ok := c.repositories[repository]; ok {
+		return Explanation{Team: team, Rule: "exact", Match: repository}
+	}
+
+	var skipped []string
+	for _, p := range c.patterns {
+		if !p.match(repository) {
+			continue
+		}
+		if exclusion, ok := c.exclusion(p.team, repository); ok {
+			skipped = append(skipped, fmt.Sprintf("%s: %s excluded by %s", p.team, p.pattern, exclusion))
+			continue
+		}
+		level.Debug(logger).Log("catalog", "static", "repository", repository, "pattern", p.pattern, "team", p.team)
+		return Explanation{Team: p.team, Rule: "pattern", Match: p.pattern, Skipped: skipped}
+	}
+	return Explanation{Team: UnknownTeam, Skipped: skipped}
+}
+
+func (c *StaticCatalog) ExplainProject(project string) Explanation {
+	if team, ok := c.projects[project]; ok {
+		return Explanation{Team: team, Rule: "project", Match: project}
+	}
+	return Explanation{Team: UnknownTeam}
+}
+
+// exclusion returns team exclusion pattern matching the repository
+func (c *StaticCatalog) exclusion(team, repository string) (string, bool) {
+	for _, p := range c.exclusions[team] {
+		if p.match(repository) {
+			return p.pattern, true
+		}
+	}
+	return "", false
+}
+
+func (c *StaticCatalog) GetTeamNameByProject(project string) string {
+	return c.ExplainProject(project).Team
+}
+
+// GetTeamNameByService returns team listing the service, falls back to project with the same name
+func (c *StaticCatalog) GetTeamNameByService(service string) string {
+	if team, ok := c.services[strings.ToLower(service)]; ok {
+		return team
+	}
+	return c.GetTeamNameByProject(service)
+}
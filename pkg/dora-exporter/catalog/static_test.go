@@ -0,0 +1,187 @@
+package catalog_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+)
+
+var patterns = `
+- name: Platform
+  github_repositories:
+    - acme/*
+  exclude_repositories:
+    - acme/sandbox-*
+- name: Payments
+  github_repositories:
+    - acme/payments-*
+    - acme/ledger
+- name: Payments Core
+  github_repositories:
+    - acme/payments-core-*
+- name: Risk
+  github_repositories:
+    - /^acme/(fraud|risk)-[a-z]+$/
+- name: Fallback
+  github_repositories:
+    - "*/*"
+`
+
+func TestStaticCatalogPatterns(t *testing.T) {
+	catalog.SetLogger(logger)
+	service := catalog.NewCatalogFromYaml(patterns)
+
+	examples := map[string]string{
+		// exact name wins over patterns
+		"acme/ledger": "Payments",
+		// longest literal prefix wins
+		"acme/payments-api":      "Payments",
+		"acme/payments-core-api": "Payments Core",
+		"acme/tools":             "Platform",
+		// regexp has acme/ literal prefix, the same as acme/*, regexp wins
+		"acme/fraud-model": "Risk",
+		"acme/risk-engine": "Risk",
+		"acme/fraud-2":     "Platform",
+		"ACME/Payments-UI": "Payments",
+		// excluded from Platform, falls through to the next pattern
+		"acme/sandbox-test": "Fallback",
+		"other/repo":        "Fallback",
+		"not_found":         "Unknown",
+	}
+
+	for repo, want := range examples {
+		got := service.GetTeamNameByRepository(repo)
+		if got != want {
+			t.Errorf("%s: wanted %s got %s", repo, want, got)
+		}
+		// cached result is the same
+		if got := service.GetTeamNameByRepository(repo); got != want {
+			t.Errorf("%s: wanted cached %s got %s", repo, want, got)
+		}
+	}
+}
+
+func TestStaticCatalogRegexp(t *testing.T) {
+	service, err := catalog.NewStaticCatalog(catalog.Teams{
+		{Name: "Platform", Repositories: []string{"acme/*"}},
+		{Name: "Risk", Repositories: []string{"/^acme/risk-.*/"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := service.GetTeamNameByRepository("acme/risk-engine"); got != "Risk" {
+		t.Errorf("Wanted Risk got %s", got)
+	}
+	if got := service.GetTeamNameByRepository("acme/fraud"); got != "Platform" {
+		t.Errorf("Wanted Platform got %s", got)
+	}
+}
+
+func TestStaticCatalogRegexpAfterGlob(t *testing.T) {
+	// glob with the same literal prefix listed earlier doesn't shadow regexp
+	service, err := catalog.NewStaticCatalog(catalog.Teams{
+		{Name: "Platform", Repositories: []string{"acme/*"}},
+		{Name: "Payments", Repositories: []string{"acme/pay*"}},
+		{Name: "Risk", Repositories: []string{"/acme/pay(ments)?-risk/"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	examples := map[string]string{
+		"acme/payments-risk": "Risk",
+		"acme/pay-risk":      "Risk",
+		"acme/payments-api":  "Payments",
+		"acme/tools":         "Platform",
+	}
+	for repo, want := range examples {
+		if got := service.GetTeamNameByRepository(repo); got != want {
+			t.Errorf("%s: wanted %s got %s", repo, want, got)
+		}
+	}
+}
+
+func TestStaticCatalogAnchoredRegexp(t *testing.T) {
+	// literal prefix of anchored regexps is taken from their source, so they outrank shorter globs
+	service, err := catalog.NewStaticCatalog(catalog.Teams{
+		{Name: "Platform", Repositories: []string{"acme/*"}},
+		{Name: "Payments", Repositories: []string{"acme/pay*"}},
+		{Name: "Payments Core", Repositories: []string{"/^acme/payments-core-.*/"}},
+		{Name: "Billing", Repositories: []string{`/^acme/payments-(invoice|tax)\-.*$/`}},
+		{Name: "Ledger", Repositories: []string{"/ledger/"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	examples := map[string]string{
+		"acme/payments-core-api":   "Payments Core",
+		"acme/payments-invoice-ui": "Billing",
+		"acme/payments-api":        "Payments",
+		// regexps match the whole name like globs
+		"other/acme/payments-core-api": "Unknown",
+		"acme/ledger":                  "Platform",
+		"ledger":                       "Ledger",
+	}
+	for repo, want := range examples {
+		if got := service.GetTeamNameByRepository(repo); got != want {
+			t.Errorf("%s: wanted %s got %s", repo, want, got)
+		}
+	}
+}
+
+func TestStaticCatalogInvalidPattern(t *testing.T) {
+	for _, repo := range []string{"/acme/(/", "acme/[a"} {
+		_, err := catalog.NewStaticCatalog(catalog.Teams{{Name: "Broken", Repositories: []string{repo}}})
+		if err == nil {
+			t.Errorf("%s: wanted error", repo)
+		}
+	}
+}
+
+func BenchmarkStaticCatalog(b *testing.B) {
+	var teams catalog.Teams
+	for i := 0; i < 500; i++ {
+		teams = append(teams, catalog.Team{
+			Name:         fmt.Sprintf("team-%d", i),
+			Repositories: []string{fmt.Sprintf("acme/repo-%d", i), fmt.Sprintf("acme/service-%d-*", i)},
+		})
+	}
+	service, err := catalog.NewStaticCatalog(teams)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		service.GetTeamNameByRepository(fmt.Sprintf("acme/service-%d-api", i%500))
+	}
+}
+
+func TestStaticCatalogServices(t *testing.T) {
+	c := catalog.NewCatalogFromYaml(`
+- name: Payments
+  jira_projects: [PAY]
+  services: [Payments API]
+- name: Risk
+  jira_projects: [risk-scoring]
+`)
+	services, ok := c.(catalog.ServiceCatalog)
+	if !ok {
+		t.Fatal("Wanted static catalog to resolve services")
+	}
+
+	examples := map[string]string{
+		"Payments API": "Payments",
+		"payments api": "Payments",
+		"risk-scoring": "Risk",
+		"Checkout":     catalog.UnknownTeam,
+	}
+	for service, want := range examples {
+		if got := services.GetTeamNameByService(service); got != want {
+			t.Errorf("%s: wanted %s got %s", service, want, got)
+		}
+	}
+}
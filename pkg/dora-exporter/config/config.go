@@ -3,6 +3,7 @@ package config
 import (
 	"io/ioutil"
 	"os"
+	"time"
 
 	"errors"
 
@@ -14,28 +15,250 @@ import (
 
 const defaultExporterFile = "dora-exporter.prom"
 
+const defaultGitlabUrl = "https://gitlab.com"
+
+const defaultBitbucketUrl = "https://api.bitbucket.org"
+
+const defaultDeploymentsProvider = "github"
+
+const defaultTeamLabel = "team"
+
+const defaultServiceLabel = "service"
+
+const defaultEventsFile = "dora-events.json"
+
+const defaultBackfillState = "dora-jira-backfill.json"
+
+const defaultEventsRetention = 90 * 24 * time.Hour
+
+const defaultEventsLimit = 10000
+
+const defaultDoraEnvironment = "production"
+
+const defaultCorrelationWindow = 24 * time.Hour
+
+const defaultDeploymentLabelPrefix = "deployment:"
+
+var defaultDoraWindows = []time.Duration{7 * 24 * time.Hour, 30 * 24 * time.Hour, 90 * 24 * time.Hour}
+
 type Github struct {
 	Owner string
 	Token string
 	//BaseUrl url.URL
+	// Rules mapping workflow_run events to deployments
+	Workflows []WorkflowRule
+	// Rules mapping published releases and pushed tags to deployments
+	Releases []ReleaseRule
+	// Issues with any of the labels are incidents, issues are ignored by default
+	IncidentLabels []string `yaml:"incident_labels"`
+	// Labels like deployment:v1.2.0 link issue to the deployment which caused it
+	DeploymentLabelPrefix string `yaml:"deployment_label_prefix"`
+}
+
+// WorkflowRule maps completed workflow runs to deployments to environment,
+// workflow, repository and branch are globs, empty values match everything
+type WorkflowRule struct {
+	// Workflow name
+	Workflow   string
+	Repository string
+	Branch     string
+	// Conclusions counted as deployments, success and failure by default
+	Conclusions []string
+	Environment string
+}
+
+// ReleaseRule maps published releases or pushed tags to deployments to environment,
+// repository and tag are globs, empty values match everything
+type ReleaseRule struct {
+	Repository string
+	Tag        string
+	// release counts published releases (default), tag counts pushed tags
+	Event string
+	// Count prereleases, skipped by default
+	Prereleases bool
+	Environment string
+}
+
+// GitLab REST API access, base url defaults to gitlab.com
+type Gitlab struct {
+	BaseUrl string `yaml:"base_url"`
+	Token   string
+	// Secret token of the webhook sent as X-Gitlab-Token, not verified when empty
+	WebhookToken string `yaml:"webhook_token"`
+}
+
+// Bitbucket Cloud API access, either username with app password or access token
+type Bitbucket struct {
+	BaseUrl  string `yaml:"base_url"`
+	Username string
+	Password string
+	Token    string
+	// Secret of the webhook used to verify X-Hub-Signature, not verified when empty
+	WebhookSecret string `yaml:"webhook_secret"`
+	// Bitbucket Data Center, shares the webhook secret
+	DataCenter BitbucketDataCenter `yaml:"data_center"`
+}
+
+// BitbucketDataCenter REST API access with HTTP access token
+type BitbucketDataCenter struct {
+	// Server url like https://bitbucket.acme.io, Data Center isn't used when empty
+	BaseUrl string `yaml:"base_url"`
+	Token   string
+	// Rules mapping pushed branches and tags to deployments
+	Deployments []RefRule
+}
+
+// RefRule maps pushed branches or tags to deployments to environment,
+// repository like PROJECT/repo and ref are globs, empty values match everything
+type RefRule struct {
+	Repository  string
+	Ref         string
+	Environment string
+}
+
+// Generic deployment webhooks of CI/CD tools like Argo CD, Flux or Jenkins
+type Deployments struct {
+	// Bearer token expected in Authorization header, not verified when empty
+	Token string
+	// Git provider used for lead time of repositories given without URL: github, gitlab or bitbucket
+	Provider string
+}
+
+// PagerDuty v3 webhook subscription
+type PagerDuty struct {
+	// Secret of the subscription used to verify X-PagerDuty-Signature, not verified when empty
+	WebhookSecret string `yaml:"webhook_secret"`
+}
+
+// Opsgenie outgoing webhook integration
+type Opsgenie struct {
+	// Bearer token expected in Authorization header, not verified when empty
+	Token string
+	// Alert priorities counted as incidents, all by default
+	Priorities []string
+}
+
+// Alertmanager webhook receiver
+type Alertmanager struct {
+	// Bearer token expected in Authorization header, not verified when empty
+	Token string
+	// Alerts matching all matchers like severity="critical" or env=~"prod.*" are incidents, severity="critical" by default
+	Matchers []string
+	// Label with the owning team, the team is resolved by service when absent
+	TeamLabel string `yaml:"team_label"`
+	// Label with the service used as project label
+	ServiceLabel string `yaml:"service_label"`
+}
+
+// Jira REST API access, either email and API token (Jira Cloud)
+// or a personal access token (Jira Data Center) when email is empty
+type Jira struct {
+	BaseUrl string `yaml:"base_url"`
+	Email   string
+	Token   string
+	// Custom field like customfield_10050 with id, SHA or version of the deployment which caused the incident
+	DeploymentField string `yaml:"deployment_field"`
+	// Labels like deployment:v1.2.0 link incident to the deployment
+	DeploymentLabelPrefix string `yaml:"deployment_label_prefix"`
+	// Query used by the backfill-jira command
+	Backfill struct {
+		JQL      string `yaml:"jql"`
+		PageSize int    `yaml:"page_size"`
+		// File with keys of imported issues, kept regardless of the event log retention
+		State string `yaml:"state"`
+	}
+}
+
+// Prometheus remote-write endpoint receiving samples with event timestamps
+type RemoteWrite struct {
+	Url         string
+	Username    string
+	Password    string
+	BearerToken string `yaml:"bearer_token"`
+	Headers     map[string]string
+	Timeout     time.Duration
+}
+
+// Performance level boundaries, zero values are replaced by DORA defaults
+type Thresholds struct {
+	// Minimal deployments per day
+	DeploymentFrequency struct {
+		Elite, High, Medium float64
+	} `yaml:"deployment_frequency"`
+	// Maximal median lead time
+	LeadTime struct {
+		Elite, High, Medium time.Duration
+	} `yaml:"lead_time"`
+	// Maximal share of failed deployments
+	ChangeFailureRate struct {
+		Elite, High, Medium float64
+	} `yaml:"change_failure_rate"`
+	// Maximal median time to restore
+	TimeToRestore struct {
+		Elite, High, Medium time.Duration
+	} `yaml:"time_to_restore"`
+}
+
+// DORA performance classification settings
+type Dora struct {
+	// Deployments to this environment are measured
+	Environment string
+	Windows     []time.Duration
+	Thresholds  Thresholds
+	// Time before incident searched for the last deployment which caused it, negative disables the heuristic
+	CorrelationWindow time.Duration `yaml:"correlation_window"`
+	Hotfix            Hotfix
+}
+
+// Hotfix patterns select deployments remediating the previous deployment of the repository, hotfixes are ignored by default
+type Hotfix struct {
+	// Deployed branch patterns like hotfix/*
+	Branches []string
+	// Pull request labels
+	Labels []string
 }
 
 type Config struct {
-	Github  Github
-	Catalog struct {
-		Mode     string
-		Endpoint string
+	Github       Github
+	Gitlab       Gitlab
+	Bitbucket    Bitbucket
+	Deployments  Deployments
+	PagerDuty    PagerDuty `yaml:"pagerduty"`
+	Opsgenie     Opsgenie
+	Alertmanager Alertmanager
+	Jira         Jira
+	Catalog      struct {
+		Mode string
+		// Ordered providers, the first knowing the team answers. Overrides mode when set.
+		Providers []string
+		// YAML or JSON file path or HTTP(S) URL with teams, replaces teams from this file
+		Source string
+		// Bearer token sent to Source URL
+		SourceToken string `yaml:"source_token"`
+		// Add parent_team and department labels resolved from the teams hierarchy
+		HierarchyLabels         bool `yaml:"hierarchy_labels"`
+		catalog.BackstageConfig `yaml:",inline"`
 	}
 	Teams  catalog.Teams
 	Server struct {
 		Port string
+		// Negotiate OpenMetrics format on /metrics
+		OpenMetrics bool `yaml:"openmetrics"`
 	}
+	RemoteWrite RemoteWrite `yaml:"remote_write"`
 	// Prometheus metrics snapshot storage
 	Storage struct {
 		File struct {
 			Path string
 		}
+		// Processed deployments and incidents
+		Events struct {
+			Path      string
+			Retention time.Duration
+			MaxEvents int `yaml:"max_events"`
+		}
 	}
+	Dora Dora
 }
 
 var logger log.Logger
@@ -72,6 +295,60 @@ func (c *Config) Load(file string) *Config {
 		c.Github.Token = os.Getenv("GITHUB_TOKEN")
 	}
 
+	if c.Gitlab.BaseUrl == "" {
+		c.Gitlab.BaseUrl = defaultGitlabUrl
+	}
+	if c.Gitlab.Token == "" {
+		c.Gitlab.Token = os.Getenv("GITLAB_TOKEN")
+	}
+
+	if c.Bitbucket.BaseUrl == "" {
+		c.Bitbucket.BaseUrl = defaultBitbucketUrl
+	}
+	if c.Bitbucket.Token == "" && c.Bitbucket.Password == "" {
+		c.Bitbucket.Token = os.Getenv("BITBUCKET_TOKEN")
+	}
+	if c.Bitbucket.DataCenter.Token == "" {
+		c.Bitbucket.DataCenter.Token = os.Getenv("BITBUCKET_DATA_CENTER_TOKEN")
+	}
+
+	if c.Deployments.Token == "" {
+		c.Deployments.Token = os.Getenv("DEPLOYMENTS_TOKEN")
+	}
+	if c.Deployments.Provider == "" {
+		c.Deployments.Provider = defaultDeploymentsProvider
+	}
+
+	if c.PagerDuty.WebhookSecret == "" {
+		c.PagerDuty.WebhookSecret = os.Getenv("PAGERDUTY_WEBHOOK_SECRET")
+	}
+	if c.Opsgenie.Token == "" {
+		c.Opsgenie.Token = os.Getenv("OPSGENIE_WEBHOOK_TOKEN")
+	}
+
+	if c.Alertmanager.Token == "" {
+		c.Alertmanager.Token = os.Getenv("ALERTMANAGER_WEBHOOK_TOKEN")
+	}
+	if c.Alertmanager.TeamLabel == "" {
+		c.Alertmanager.TeamLabel = defaultTeamLabel
+	}
+	if c.Alertmanager.ServiceLabel == "" {
+		c.Alertmanager.ServiceLabel = defaultServiceLabel
+	}
+
+	if c.Jira.Token == "" {
+		c.Jira.Token = os.Getenv("JIRA_TOKEN")
+	}
+	if c.Jira.DeploymentLabelPrefix == "" {
+		c.Jira.DeploymentLabelPrefix = defaultDeploymentLabelPrefix
+	}
+	if c.Jira.Backfill.State == "" {
+		c.Jira.Backfill.State = defaultBackfillState
+	}
+	if c.Github.DeploymentLabelPrefix == "" {
+		c.Github.DeploymentLabelPrefix = defaultDeploymentLabelPrefix
+	}
+
 	if c.Storage.File.Path == "" {
 		if os.Getenv("STORAGE_FILE_PATH") != "" {
 			c.Storage.File.Path = os.Getenv("STORAGE_FILE_PATH")
@@ -81,6 +358,35 @@ func (c *Config) Load(file string) *Config {
 	}
 	level.Info(logger).Log("config", "storage", "file", c.Storage.File.Path)
 
+	if c.Storage.Events.Path == "" {
+		if os.Getenv("STORAGE_EVENTS_PATH") != "" {
+			c.Storage.Events.Path = os.Getenv("STORAGE_EVENTS_PATH")
+		} else {
+			c.Storage.Events.Path = defaultEventsFile
+		}
+	}
+	if c.Storage.Events.Retention == 0 {
+		c.Storage.Events.Retention = defaultEventsRetention
+	}
+	if c.Storage.Events.MaxEvents == 0 {
+		c.Storage.Events.MaxEvents = defaultEventsLimit
+	}
+	level.Info(logger).Log("config", "storage", "events", c.Storage.Events.Path, "retention", c.Storage.Events.Retention)
+
+	if c.Dora.Environment == "" {
+		c.Dora.Environment = defaultDoraEnvironment
+	}
+	if c.Dora.CorrelationWindow == 0 {
+		c.Dora.CorrelationWindow = defaultCorrelationWindow
+	}
+	if len(c.Dora.Windows) == 0 {
+		c.Dora.Windows = defaultDoraWindows
+	}
+
+	if c.RemoteWrite.Url != "" && c.RemoteWrite.BearerToken == "" {
+		c.RemoteWrite.BearerToken = os.Getenv("REMOTE_WRITE_TOKEN")
+	}
+
 	for _, team := range c.Teams {
 		level.Info(logger).Log("config", "load", "team", team.Name, "repos", len(team.Repositories), "projects", len(team.Projects))
 	}
@@ -89,6 +395,12 @@ func (c *Config) Load(file string) *Config {
 		// default is static when not specified
 		c.Catalog.Mode = "static"
 	}
+	if c.Catalog.Token == "" {
+		c.Catalog.Token = os.Getenv("BACKSTAGE_TOKEN")
+	}
+	if c.Catalog.SourceToken == "" {
+		c.Catalog.SourceToken = os.Getenv("CATALOG_SOURCE_TOKEN")
+	}
 
 	level.Info(logger).Log("config", "finished", "file", file)
 	return c
@@ -0,0 +1,145 @@
+package dashboard
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/dora"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+)
+
+//go:embed templates static
+var content embed.FS
+
+// Amount of weeks shown in trends
+const trendWeeks = 12
+
+// Amount of events shown in the event log
+const recentEvents = 50
+
+var logger log.Logger
+
+func SetLogger(log log.Logger) {
+	logger = log
+	return
+}
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"duration": formatDuration,
+	"percent": func(v float64) string {
+		return fmt.Sprintf("%.0f%%", v*100)
+	},
+	"frequency": func(v float64) string {
+		return fmt.Sprintf("%.2f", v)
+	},
+}).ParseFS(content, "templates/*.html"))
+
+// formatDuration prints seconds as days, hours and minutes
+func formatDuration(seconds float64) string {
+	if seconds <= 0 {
+		return "-"
+	}
+	d := time.Duration(seconds) * time.Second
+	days := d / (24 * time.Hour)
+	hours := (d % (24 * time.Hour)) / time.Hour
+	minutes := (d % time.Hour) / time.Minute
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+// Week is a trend bucket, widths are relative to the maximum of the shown weeks in percents
+type Week struct {
+	From             time.Time
+	Metrics          dora.Metrics
+	DeploymentsWidth int
+	LeadTimeWidth    int
+}
+
+type Page struct {
+	Team   string
+	Teams  []string
+	Report dora.Report
+	Weeks  []Week
+	Events []events.Event
+}
+
+// NewPage builds dashboard data for the team, empty team shows all teams
+func NewPage(team string, now time.Time) Page {
+	page := Page{Team: team, Report: dora.NewReport(now)}
+
+	store := events.GetStore()
+	if store != nil {
+		page.Teams = store.Teams()
+	}
+
+	if team != "" {
+		var teams []dora.TeamReport
+		for _, t := range page.Report.Teams {
+			if t.Team == team {
+				teams = append(teams, t)
+			}
+		}
+		page.Report.Teams = teams
+	}
+
+	var maxDeployments, maxLeadTime float64
+	end := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+	for i := trendWeeks; i > 0; i-- {
+		from := end.Add(-time.Duration(i) * 7 * 24 * time.Hour)
+		week := Week{From: from, Metrics: dora.TeamMetrics(team, from, from.Add(7*24*time.Hour))}
+		maxDeployments = math.Max(maxDeployments, float64(week.Metrics.Deployments))
+		maxLeadTime = math.Max(maxLeadTime, week.Metrics.LeadTime)
+		page.Weeks = append(page.Weeks, week)
+	}
+	for i := range page.Weeks {
+		if maxDeployments > 0 {
+			page.Weeks[i].DeploymentsWidth = int(float64(page.Weeks[i].Metrics.Deployments) / maxDeployments * 100)
+		}
+		if maxLeadTime > 0 {
+			page.Weeks[i].LeadTimeWidth = int(page.Weeks[i].Metrics.LeadTime / maxLeadTime * 100)
+		}
+	}
+
+	if store != nil {
+		all := store.Query(events.Query{Team: team})
+		for i := len(all) - 1; i >= 0 && len(page.Events) < recentEvents; i-- {
+			page.Events = append(page.Events, all[i])
+		}
+	}
+
+	return page
+}
+
+// Handler serves the dashboard page, team is selected with ?team= query
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/dashboard/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	page := NewPage(r.URL.Query().Get("team"), time.Now())
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := templates.ExecuteTemplate(w, "index.html", page)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "dashboard", "error", err)
+	}
+}
+
+// StaticHandler serves embedded stylesheets under /dashboard/static/
+func StaticHandler() http.Handler {
+	static, _ := fs.Sub(content, "static")
+	return http.StripPrefix("/dashboard/static/", http.FileServer(http.FS(static)))
+}
@@ -0,0 +1,32 @@
+package dashboard_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/dashboard"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+)
+
+func TestHandler(t *testing.T) {
+	store := events.NewStore("", 0, 0)
+	store.Add(events.Event{Id: "github/1", Type: events.Deployment, Time: time.Now().Add(-time.Hour),
+		Team: "Infra", Repo: "provisioner", Environment: "production", Status: "success", LeadTime: 5400})
+	events.SetStore(store)
+	defer events.SetStore(nil)
+
+	rec := httptest.NewRecorder()
+	dashboard.Handler(rec, httptest.NewRequest(http.MethodGet, "/dashboard/?team=Infra", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Wanted 200 got %d", rec.Code)
+	}
+	for _, want := range []string{"provisioner", "1h 30m", `<option value="Infra" selected>`} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("Wanted dashboard to contain %s", want)
+		}
+	}
+}
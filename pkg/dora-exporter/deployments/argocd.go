@@ -0,0 +1,98 @@
+package deployments
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ArgoApplication is the part of Argo CD Application resource describing the last sync
+type ArgoApplication struct {
+	Metadata struct {
+		Name      string
+		Namespace string
+	}
+	Spec struct {
+		Source  ArgoSource
+		Sources []ArgoSource
+		// Destination namespace is the environment when payload has none
+		Destination struct {
+			Name      string
+			Namespace string
+		}
+	}
+	Status struct {
+		OperationState struct {
+			// Running, Succeeded, Failed, Error or Terminating
+			Phase      string
+			StartedAt  time.Time `json:"startedAt"`
+			FinishedAt time.Time `json:"finishedAt"`
+			SyncResult struct {
+				Revision  string
+				Revisions []string
+			} `json:"syncResult"`
+		} `json:"operationState"`
+	}
+}
+
+type ArgoSource struct {
+	RepoURL string `json:"repoURL"`
+}
+
+// ArgoPayload is sent by Argo CD notifications webhook template, see README
+type ArgoPayload struct {
+	App         ArgoApplication `json:"app"`
+	Environment string          `json:"environment"`
+	Team        string          `json:"team"`
+}
+
+// argoStatuses maps sync operation phases to deployment statuses
+var argoStatuses = map[string]string{"Succeeded": "success", "Failed": "failure", "Error": "failure"}
+
+// Payload returns synced repository and revision as a generic deployment,
+// the first source is used for multi-source applications
+func (payload ArgoPayload) Payload() (Payload, error) {
+	app := payload.App
+	operation := app.Status.OperationState
+
+	status, ok := argoStatuses[operation.Phase]
+	if !ok {
+		return Payload{Repo: app.Metadata.Name, Status: operation.Phase}, ErrIgnored
+	}
+
+	repo, revision := app.Spec.Source.RepoURL, operation.SyncResult.Revision
+	if repo == "" && len(app.Spec.Sources) > 0 {
+		repo = app.Spec.Sources[0].RepoURL
+		if len(operation.SyncResult.Revisions) > 0 {
+			revision = operation.SyncResult.Revisions[0]
+		}
+	}
+
+	environment := payload.Environment
+	if environment == "" {
+		environment = app.Spec.Destination.Namespace
+	}
+
+	return Payload{
+		Id:          rolloutId(fmt.Sprintf("argocd/%s/%s/%s", app.Metadata.Namespace, app.Metadata.Name, revision), operation.StartedAt),
+		Repo:        repo,
+		Sha:         revision,
+		Environment: environment,
+		Status:      status,
+		Timestamp:   operation.FinishedAt,
+		Team:        payload.Team,
+		Source:      "argocd",
+	}, nil
+}
+
+// ArgoCDHandler receives Argo CD notifications sent on sync operation completion
+func ArgoCDHandler(w http.ResponseWriter, r *http.Request) {
+	record(w, r, "argocd", func(r *http.Request) (Payload, error) {
+		var payload ArgoPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			return Payload{}, err
+		}
+		return payload.Payload()
+	})
+}
@@ -0,0 +1,268 @@
+// Package deployments receives deployments from CI/CD tools without a dedicated integration,
+// either in the generic format or as Argo CD notifications and Flux alerts
+package deployments
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
+)
+
+var logger log.Logger
+
+func SetLogger(log log.Logger) {
+	logger = log
+	return
+}
+
+var cat catalog.TeamsCatalog
+
+func SetCatalog(catalog catalog.TeamsCatalog) {
+	cat = catalog
+	level.Info(logger).Log("deployments", "catalog service set")
+}
+
+var (
+	token           string
+	defaultProvider = "github"
+	// git provider by host of repository URL
+	providerHosts = map[string]string{
+		"github.com":    "github",
+		"gitlab.com":    "gitlab",
+		"bitbucket.org": "bitbucket",
+	}
+)
+
+// SetDeployments configures webhook token and git providers, hosts of self-managed GitLab
+// and Bitbucket Data Center are detected as gitlab and bitbucket_data_center
+func SetDeployments(conf config.Deployments, gitlab config.Gitlab, bitbucket config.BitbucketDataCenter) {
+	token = conf.Token
+	if conf.Provider != "" {
+		defaultProvider = conf.Provider
+	}
+	if u, err := url.Parse(gitlab.BaseUrl); err == nil && u.Host != "" {
+		providerHosts[u.Host] = "gitlab"
+	}
+	if u, err := url.Parse(bitbucket.BaseUrl); err == nil && u.Host != "" {
+		providerHosts[u.Hostname()] = "bitbucket_data_center"
+	}
+}
+
+// Payload is a deployment in the generic format
+type Payload struct {
+	// Unique identifier, statuses with the same id replace each other. Derived from repo, environment, sha and timestamp when empty.
+	Id          string    `json:"id"`
+	Repo        string    `json:"repo"`
+	Sha         string    `json:"sha"`
+	Environment string    `json:"environment"`
+	Status      string    `json:"status"`
+	Timestamp   time.Time `json:"timestamp"`
+	// Owner of the repository, resolved by the catalog when empty
+	Team string `json:"team"`
+	// Git provider used for lead time, detected from repo URL or configured default when empty
+	Provider string `json:"provider"`
+	// Tool reporting the deployment, e.g. jenkins
+	Source string `json:"source"`
+	Url    string `json:"url"`
+	// Deployed branch or tag and labels of the change, matched against hotfix patterns
+	Ref    string   `json:"ref"`
+	Labels []string `json:"labels"`
+}
+
+// Validate checks required fields
+func (payload Payload) Validate() error {
+	var missing []string
+	fields := []struct{ name, value string }{
+		{"repo", payload.Repo},
+		{"sha", payload.Sha},
+		{"environment", payload.Environment},
+		{"status", payload.Status},
+	}
+	for _, field := range fields {
+		if field.value == "" {
+			missing = append(missing, field.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Statuses counted as deployments, the others like in_progress or pending are ignored
+var (
+	successStatuses = map[string]bool{"success": true, "succeeded": true, "successful": true}
+	failureStatuses = map[string]bool{"failure": true, "failed": true, "error": true}
+)
+
+// normalizeStatus returns success or failure, ok is false for statuses which are not final
+func normalizeStatus(status string) (normalized string, ok bool) {
+	status = strings.ToLower(status)
+	switch {
+	case successStatuses[status]:
+		return "success", true
+	case failureStatuses[status]:
+		return "failure", true
+	}
+	return status, false
+}
+
+// ParseRepository returns git provider and full name of repository given by URL,
+// SSH address like git@github.com:org/repo.git or full name like org/repo
+func ParseRepository(repository string) (provider, fullName string) {
+	repository = strings.TrimSuffix(strings.TrimSuffix(repository, "/"), ".git")
+
+	host := ""
+	if u, err := url.Parse(repository); err == nil && u.Host != "" {
+		host, fullName = u.Hostname(), strings.TrimPrefix(u.Path, "/")
+	} else if at, colon := strings.Index(repository, "@"), strings.Index(repository, ":"); at >= 0 && colon > at {
+		host, fullName = repository[at+1:colon], repository[colon+1:]
+	} else {
+		fullName = repository
+	}
+
+	provider, ok := providerHosts[host]
+	if !ok {
+		provider = defaultProvider
+	}
+	// Data Center clone URLs look like https://bitbucket.acme.io/scm/PROJECT/repo.git
+	if provider == "bitbucket_data_center" {
+		fullName = strings.TrimPrefix(fullName, "scm/")
+	}
+	return provider, fullName
+}
+
+// ErrIgnored is returned for events which are not deployments, e.g. still in progress
+var ErrIgnored = errors.New("not a finished deployment")
+
+// rolloutId appends unix time the rollout started at to id, so a rollback or redeploy
+// of the commit is a new deployment. Id is kept when the time is unknown.
+func rolloutId(id string, at time.Time) string {
+	if at.IsZero() {
+		return id
+	}
+	return id + "/" + strconv.FormatInt(at.Unix(), 10)
+}
+
+// NewDeployment resolves team and lead time of the deployment
+func NewDeployment(payload Payload) (tracker.Deployment, error) {
+	if err := payload.Validate(); err != nil {
+		return tracker.Deployment{}, err
+	}
+	status, ok := normalizeStatus(payload.Status)
+	if !ok {
+		return tracker.Deployment{}, ErrIgnored
+	}
+
+	provider, fullName := ParseRepository(payload.Repo)
+	if payload.Provider != "" {
+		provider = payload.Provider
+	}
+	source := payload.Source
+	if source == "" {
+		source = "api"
+	}
+	at := payload.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	d := tracker.Deployment{
+		Id:           payload.Id,
+		Source:       source,
+		Time:         at,
+		Repo:         path.Base(fullName),
+		Environment:  payload.Environment,
+		Team:         payload.Team,
+		Status:       status,
+		Sha:          payload.Sha,
+		Failed:       status == "failure",
+		Ref:          payload.Ref,
+		ChangeLabels: payload.Labels,
+		Provider:     provider,
+		Repository:   fullName,
+	}
+	if d.Id == "" {
+		d.Id = rolloutId(fmt.Sprintf("%s/%s/%s/%s", source, fullName, payload.Environment, payload.Sha), payload.Timestamp)
+	}
+	if d.Team == "" {
+		d.Team, d.Catalog = catalog.ResolveRepository(cat, fullName)
+	}
+	if d.Team == catalog.UnknownTeam {
+		d.Errors = append(d.Errors, "catalog: no team for repository "+fullName)
+	}
+
+	duration, change, err := tracker.LeadTime(provider, fullName, payload.Sha, at)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "deployments", "repository", fullName, "sha", payload.Sha, "error", err)
+		d.Errors = append(d.Errors, "lead time: "+err.Error())
+	} else {
+		d.LeadTime = duration
+		d.HasLeadTime = true
+	}
+
+	d.Exemplar = prom.NewExemplar(
+		"deployment_url", payload.Url,
+		"sha", d.Sha,
+		"deployment_id", d.Id,
+		"pull_request", change,
+	)
+	return d, nil
+}
+
+// authorized verifies bearer token when configured
+func authorized(r *http.Request) bool {
+	return token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) == 1
+}
+
+// record writes response for the payload decoded from request body by decode
+func record(w http.ResponseWriter, r *http.Request, endpoint string, decode func(r *http.Request) (Payload, error)) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	payload, err := decode(r)
+	if err == nil {
+		var d tracker.Deployment
+		if d, err = NewDeployment(payload); err == nil {
+			tracker.RecordDeployment(d)
+			return
+		}
+	}
+
+	if errors.Is(err, ErrIgnored) {
+		level.Debug(logger).Log("endpoint", endpoint, "repository", payload.Repo, "status", payload.Status, "ignored", err)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	level.Error(logger).Log("endpoint", endpoint, "error", err)
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// DeploymentsHandler receives deployments in the generic format
+func DeploymentsHandler(w http.ResponseWriter, r *http.Request) {
+	record(w, r, "deployments", func(r *http.Request) (Payload, error) {
+		var payload Payload
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		return payload, err
+	})
+}
@@ -0,0 +1,274 @@
+package deployments_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/deployments"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/internal/testenv"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const sha = "b83d6e391c22777fca1ed3012fce84f633d7fed0"
+
+// firstCommit is 10 hours before deployments of the tests
+var firstCommit = time.Date(2021, 4, 28, 11, 0, 0, 0, time.UTC)
+
+func setup(t *testing.T) (*events.Store, *prom.Exporter, map[string]string) {
+	store, exporter := testenv.Setup(t, deployments.SetLogger)
+
+	deployments.SetDeployments(config.Deployments{Token: "secret"}, config.Gitlab{BaseUrl: "https://git.acme.io"}, config.BitbucketDataCenter{BaseUrl: "https://bitbucket.acme.io"})
+	static := catalog.NewCatalogFromYaml("- name: Payments\n  github_repositories: [acme/payments]\n")
+	deployments.SetCatalog(catalog.NewComposite(catalog.Provider{Name: "static", Catalog: static}))
+
+	// repositories looked up by provider
+	lookups := map[string]string{}
+	for _, provider := range []string{"github", "gitlab", "bitbucket"} {
+		provider := provider
+		tracker.SetCommitLookup(provider, func(repository, commit string) (time.Time, string, error) {
+			lookups[provider] = repository
+			if commit != sha {
+				return time.Time{}, "", errors.New("unknown commit")
+			}
+			return firstCommit, "42", nil
+		})
+	}
+
+	return store, exporter, lookups
+}
+
+func post(handler http.HandlerFunc, token, body string) *httptest.ResponseRecorder {
+	return testenv.Post(handler, "/api/v1/deployments", body, "Authorization", "Bearer "+token)
+}
+
+func deploy(token string, payload deployments.Payload) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	return post(deployments.DeploymentsHandler, token, string(body))
+}
+
+func TestParseRepository(t *testing.T) {
+	setup(t)
+
+	tests := []struct{ repository, provider, fullName string }{
+		{"acme/payments", "github", "acme/payments"},
+		{"https://github.com/acme/payments.git", "github", "acme/payments"},
+		{"git@gitlab.com:acme/group/payments.git", "gitlab", "acme/group/payments"},
+		{"ssh://git@bitbucket.org/acme/payments", "bitbucket", "acme/payments"},
+		{"https://git.acme.io/acme/payments/", "gitlab", "acme/payments"},
+		{"https://bitbucket.acme.io/scm/PAY/payments.git", "bitbucket_data_center", "PAY/payments"},
+		{"ssh://git@bitbucket.acme.io:7999/pay/payments.git", "bitbucket_data_center", "pay/payments"},
+	}
+	for _, test := range tests {
+		provider, fullName := deployments.ParseRepository(test.repository)
+		if provider != test.provider || fullName != test.fullName {
+			t.Errorf("%s: wanted %s %s got %s %s", test.repository, test.provider, test.fullName, provider, fullName)
+		}
+	}
+}
+
+func TestDeploymentsHandler(t *testing.T) {
+	store, exporter, lookups := setup(t)
+
+	examples := []struct {
+		Name    string
+		Payload deployments.Payload
+		Id      string
+		Team    string
+		Catalog string
+		Status  string
+		// Provider and repository of the lead time lookup
+		Provider   string
+		Repository string
+		LeadTime   float64
+		Errors     int
+	}{
+		{
+			Name:    "github",
+			Payload: deployments.Payload{Repo: "acme/payments", Sha: sha, Environment: "production", Status: "SUCCESS", Timestamp: time.Date(2021, 4, 28, 21, 0, 0, 0, time.UTC), Source: "jenkins"},
+			Id:      "jenkins/acme/payments/production/" + sha + "/1619643600",
+			Team:    "Payments", Catalog: "static", Status: "success",
+			Provider: "github", Repository: "acme/payments",
+			LeadTime: (10 * time.Hour).Seconds(),
+		},
+		{
+			// explicit team and id, failed lead time lookup is recorded as error
+			Name:    "gitlab",
+			Payload: deployments.Payload{Id: "deploy-1", Repo: "https://gitlab.com/acme/api", Sha: "c0ffee", Environment: "staging", Status: "failed", Team: "Core"},
+			Id:      "deploy-1",
+			Team:    "Core", Status: "failure",
+			Provider: "gitlab", Repository: "acme/api",
+			Errors: 1,
+		},
+	}
+	for _, example := range examples {
+		if rec := deploy("secret", example.Payload); rec.Code != http.StatusOK {
+			t.Fatalf("%s: wanted 200 got %d: %s", example.Name, rec.Code, rec.Body)
+		}
+		e, ok := store.Get(example.Id)
+		if !ok {
+			t.Errorf("%s: wanted deployment event %s", example.Name, example.Id)
+			continue
+		}
+		if e.Team != example.Team || e.Catalog != example.Catalog || e.Status != example.Status || e.Failed != (example.Status == "failure") ||
+			e.LeadTime != example.LeadTime || len(e.Errors) != example.Errors {
+			t.Errorf("%s: unexpected event %+v", example.Name, e)
+		}
+		if lookups[example.Provider] != example.Repository {
+			t.Errorf("%s: wanted %s lookup of %s got %v", example.Name, example.Provider, example.Repository, lookups)
+		}
+	}
+
+	success := prometheus.Labels{"repo": "payments", "environment": "production", "team": "Payments", "status": "success"}
+	if got := testenv.Value(t, exporter, "github_deployments_total", success); got != 1 {
+		t.Errorf("Wanted 1 successful deployment got %v", got)
+	}
+	if got := testenv.Value(t, exporter, "github_deployments_duration_sum", success); got != (10 * time.Hour).Seconds() {
+		t.Errorf("Wanted 10h lead time sum got %v", got)
+	}
+	// lead time of the failed lookup isn't observed
+	failure := prometheus.Labels{"repo": "api", "environment": "staging", "team": "Core", "status": "failure"}
+	if got := testenv.Value(t, exporter, "github_deployments_total", failure); got != 1 {
+		t.Errorf("Wanted 1 failed deployment got %v", got)
+	}
+	if got := testenv.Value(t, exporter, "github_deployments_lead_time_seconds", failure); got != 0 {
+		t.Errorf("Wanted no lead time of failed lookup got %v", got)
+	}
+}
+
+func TestDeploymentsHandlerRollback(t *testing.T) {
+	store, exporter, _ := setup(t)
+	tracker.SetHotfix(nil, nil)
+
+	examples := []struct {
+		Sha  string
+		Time time.Time
+		Id   string
+		// failure reason of the deployment after all of them
+		Reason string
+	}{
+		{Sha: sha, Time: time.Date(2021, 4, 28, 21, 0, 0, 0, time.UTC), Id: "api/acme/payments/production/" + sha + "/1619643600"},
+		{Sha: "c0ffee", Time: time.Date(2021, 4, 28, 22, 0, 0, 0, time.UTC), Id: "api/acme/payments/production/c0ffee/1619647200", Reason: tracker.ReasonRollback},
+		// rollback to the earlier commit is a new deployment
+		{Sha: sha, Time: time.Date(2021, 4, 28, 23, 0, 0, 0, time.UTC), Id: "api/acme/payments/production/" + sha + "/1619650800"},
+	}
+	for _, example := range examples {
+		rec := deploy("secret", deployments.Payload{Repo: "acme/payments", Sha: example.Sha, Environment: "production", Status: "success", Timestamp: example.Time})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Wanted 200 got %d: %s", rec.Code, rec.Body)
+		}
+	}
+	for _, example := range examples {
+		e, ok := store.Get(example.Id)
+		if !ok || e.FailureReason != example.Reason {
+			t.Errorf("%s: wanted failure reason %q got %v %+v", example.Id, example.Reason, ok, e)
+		}
+	}
+	if got := testenv.Value(t, exporter, "github_deployments_total", prometheus.Labels{"repo": "payments", "status": "success"}); got != 3 {
+		t.Errorf("Wanted 3 deployments got %v", got)
+	}
+	if got := testenv.Value(t, exporter, "github_deployments_failed_total", prometheus.Labels{"repo": "payments", "reason": tracker.ReasonRollback}); got != 1 {
+		t.Errorf("Wanted 1 rolled back deployment got %v", got)
+	}
+}
+
+func TestDeploymentsHandlerRejects(t *testing.T) {
+	setup(t)
+
+	examples := []struct {
+		Name    string
+		Token   string
+		Payload deployments.Payload
+		Status  int
+		Error   string
+	}{
+		{Name: "wrong token", Token: "wrong", Status: http.StatusUnauthorized},
+		{Name: "missing fields", Token: "secret", Payload: deployments.Payload{Repo: "acme/payments", Status: "success"}, Status: http.StatusBadRequest, Error: "missing sha, environment"},
+		{Name: "in progress", Token: "secret", Payload: deployments.Payload{Repo: "acme/payments", Sha: "c0ffee", Environment: "production", Status: "in_progress"}, Status: http.StatusAccepted},
+	}
+	for _, example := range examples {
+		rec := deploy(example.Token, example.Payload)
+		if rec.Code != example.Status || !strings.Contains(rec.Body.String(), example.Error) {
+			t.Errorf("%s: wanted %d %q got %d: %s", example.Name, example.Status, example.Error, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestArgoCDHandler(t *testing.T) {
+	store, exporter, _ := setup(t)
+
+	examples := []struct {
+		Phase  string
+		Status int
+	}{
+		// running sync isn't counted
+		{Phase: "Running", Status: http.StatusAccepted},
+		{Phase: "Succeeded", Status: http.StatusOK},
+	}
+	for _, example := range examples {
+		if rec := post(deployments.ArgoCDHandler, "secret", testenv.Fixture(t, "argocd.json", example)); rec.Code != example.Status {
+			t.Fatalf("%s: wanted %d got %d: %s", example.Phase, example.Status, rec.Code, rec.Body)
+		}
+	}
+
+	e, ok := store.Get("argocd/argocd/payments/" + sha + "/1619643300")
+	if !ok {
+		t.Fatal("Wanted deployment event")
+	}
+	if e.Source != "argocd" || e.Team != "Payments" || e.Environment != "production" || e.LeadTime != (10*time.Hour).Seconds() {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if got := testenv.Value(t, exporter, "github_deployments_total", prometheus.Labels{"repo": "payments"}); got != 1 {
+		t.Errorf("Wanted 1 deployment got %v", got)
+	}
+}
+
+func TestFluxHandler(t *testing.T) {
+	store, exporter, _ := setup(t)
+
+	examples := []struct {
+		Severity string
+		Reason   string
+		Status   int
+	}{
+		{Severity: "info", Reason: "Progressing", Status: http.StatusAccepted},
+		{Severity: "error", Reason: "HealthCheckFailed", Status: http.StatusOK},
+	}
+	for _, example := range examples {
+		if rec := post(deployments.FluxHandler, "secret", testenv.Fixture(t, "flux.json", example)); rec.Code != example.Status {
+			t.Fatalf("%s: wanted %d got %d: %s", example.Reason, example.Status, rec.Code, rec.Body)
+		}
+	}
+
+	e, ok := store.Get("flux/kustomization/flux-system/payments/" + sha + "/1619643600")
+	if !ok {
+		t.Fatal("Wanted deployment event")
+	}
+	if e.Source != "flux" || !e.Failed || e.Sha != sha || e.Environment != "production" || e.Team != "Payments" {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if got := testenv.Value(t, exporter, "github_deployments_total", prometheus.Labels{"repo": "payments", "status": "failure"}); got != 1 {
+		t.Errorf("Wanted 1 failed deployment got %v", got)
+	}
+}
+
+func TestFluxRevisionSha(t *testing.T) {
+	for revision, want := range map[string]string{
+		"main@sha1:" + sha: sha,
+		"main/" + sha:      sha,
+		sha:                sha,
+	} {
+		if got := deployments.FluxRevisionSha(revision); got != want {
+			t.Errorf("%s: wanted %s got %s", revision, want, got)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package deployments
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FluxEvent is sent by Flux notification-controller generic provider
+type FluxEvent struct {
+	InvolvedObject struct {
+		Kind      string
+		Namespace string
+		Name      string
+	} `json:"involvedObject"`
+	// info or error
+	Severity  string
+	Timestamp time.Time
+	Message   string
+	Reason    string
+	// Revision reported by the controller along with eventMetadata of the Alert
+	Metadata map[string]string
+}
+
+// Reasons of info events counted as successful deployments
+var fluxSuccessReasons = map[string]bool{
+	"ReconciliationSucceeded": true,
+	"InstallSucceeded":        true,
+	"UpgradeSucceeded":        true,
+}
+
+// metadata returns value of the key, controllers prefix keys with API group like kustomize.toolkit.fluxcd.io/revision
+func (event FluxEvent) metadata(key string) string {
+	if value, ok := event.Metadata[key]; ok {
+		return value
+	}
+	for k, value := range event.Metadata {
+		if strings.HasSuffix(k, "/"+key) {
+			return value
+		}
+	}
+	return ""
+}
+
+// FluxRevisionSha returns commit sha of revision like main@sha1:<sha> or legacy main/<sha>
+func FluxRevisionSha(revision string) string {
+	if i := strings.LastIndex(revision, ":"); i >= 0 {
+		return revision[i+1:]
+	}
+	if i := strings.LastIndex(revision, "/"); i >= 0 {
+		return revision[i+1:]
+	}
+	return revision
+}
+
+// Payload returns generic deployment, repository and environment are taken from eventMetadata of the Alert
+func (event FluxEvent) Payload() (Payload, error) {
+	repo := event.metadata("repo")
+
+	var status string
+	switch {
+	case event.Severity == "error":
+		status = "failure"
+	case fluxSuccessReasons[event.Reason]:
+		status = "success"
+	default:
+		return Payload{Repo: repo, Status: event.Reason}, ErrIgnored
+	}
+
+	sha := event.metadata("sha")
+	if sha == "" {
+		sha = FluxRevisionSha(event.metadata("revision"))
+	}
+	environment := event.metadata("environment")
+	if environment == "" {
+		environment = event.InvolvedObject.Namespace
+	}
+
+	object := event.InvolvedObject
+	return Payload{
+		Id:          rolloutId(fmt.Sprintf("flux/%s/%s/%s/%s", strings.ToLower(object.Kind), object.Namespace, object.Name, sha), event.Timestamp),
+		Repo:        repo,
+		Sha:         sha,
+		Environment: environment,
+		Status:      status,
+		Timestamp:   event.Timestamp,
+		Team:        event.metadata("team"),
+		Provider:    event.metadata("provider"),
+		Source:      "flux",
+	}, nil
+}
+
+// FluxHandler receives Flux alerts of Kustomization and HelmRelease reconciliations
+func FluxHandler(w http.ResponseWriter, r *http.Request) {
+	record(w, r, "flux", func(r *http.Request) (Payload, error) {
+		var event FluxEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			return Payload{}, err
+		}
+		return event.Payload()
+	})
+}
@@ -0,0 +1,124 @@
+package dora
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+const defaultRange = 30 * day
+
+// Durations summarize distribution of durations in seconds
+type Durations struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P75   float64 `json:"p75"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+}
+
+func NewDurations(values []float64) Durations {
+	d := Durations{
+		Count: len(values),
+		P50:   Percentile(values, 50),
+		P75:   Percentile(values, 75),
+		P90:   Percentile(values, 90),
+		P95:   Percentile(values, 95),
+	}
+	for _, v := range values {
+		d.Mean += v
+	}
+	if len(values) > 0 {
+		d.Mean /= float64(len(values))
+	}
+	return d
+}
+
+type TeamMetricsResponse struct {
+	Team              string    `json:"team"`
+	Environment       string    `json:"environment"`
+	From              time.Time `json:"from"`
+	To                time.Time `json:"to"`
+	Deployments       int       `json:"deployments"`
+	FailedDeployments int       `json:"failed_deployments"`
+	// Deployments per day
+	DeploymentFrequency float64   `json:"deployment_frequency"`
+	LeadTime            Durations `json:"lead_time"`
+	ChangeFailureRate   float64   `json:"change_failure_rate"`
+	Incidents           int       `json:"incidents"`
+	TimeToRestore       Durations `json:"time_to_restore"`
+}
+
+// NewTeamMetricsResponse computes metrics of the team from stored events
+func NewTeamMetricsResponse(team, environment string, from, to time.Time) TeamMetricsResponse {
+	deployments, incidents := TeamEvents(team, environment, from, to)
+	metrics := Compute(deployments, incidents, from, to)
+
+	return TeamMetricsResponse{
+		Team:                team,
+		Environment:         environment,
+		From:                from,
+		To:                  to,
+		Deployments:         metrics.Deployments,
+		FailedDeployments:   metrics.FailedDeployments,
+		DeploymentFrequency: metrics.DeploymentFrequency,
+		LeadTime:            NewDurations(LeadTimes(deployments)),
+		ChangeFailureRate:   metrics.ChangeFailureRate,
+		Incidents:           metrics.Incidents,
+		TimeToRestore:       NewDurations(RestoreTimes(incidents)),
+	}
+}
+
+// parseTime accepts RFC3339 timestamp or date
+func parseTime(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// TeamsHandler serves /api/v1/teams/{team}/metrics?from=&to=&environment=
+func TeamsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/teams/")
+	i := strings.LastIndex(path, "/")
+	if i <= 0 || path[i+1:] != "metrics" {
+		http.NotFound(w, r)
+		return
+	}
+	team := path[:i]
+
+	query := r.URL.Query()
+	to, err := parseTime(query.Get("to"), time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid to: %s", err), http.StatusBadRequest)
+		return
+	}
+	from, err := parseTime(query.Get("from"), to.Add(-defaultRange))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid from: %s", err), http.StatusBadRequest)
+		return
+	}
+	if !from.Before(to) {
+		http.Error(w, "from should be before to", http.StatusBadRequest)
+		return
+	}
+
+	environment := query.Get("environment")
+	if environment == "" {
+		environment = conf.Environment
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(NewTeamMetricsResponse(team, environment, from, to))
+	if err != nil {
+		level.Error(logger).Log("endpoint", "teams", "team", team, "error", err)
+	}
+}
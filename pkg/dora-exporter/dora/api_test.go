@@ -0,0 +1,64 @@
+package dora_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/dora"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+)
+
+func TestTeamsHandler(t *testing.T) {
+	dora.SetLogger(log.NewLogfmtLogger(os.Stderr))
+	dora.SetConfig(config.Dora{Environment: "production"})
+
+	store := events.NewStore("", 0, 0)
+	for i, leadTime := range []time.Duration{time.Hour, 2 * time.Hour, 4 * time.Hour} {
+		store.Add(events.Event{Type: events.Deployment, Time: now.Add(-time.Duration(i+1) * 24 * time.Hour),
+			Team: "Infra", Environment: "production", Status: "success", LeadTime: leadTime.Seconds()})
+	}
+	store.Add(events.Event{Type: events.Deployment, Time: now.Add(-time.Hour),
+		Team: "Infra", Environment: "staging", Status: "success", LeadTime: 60})
+	events.SetStore(store)
+	defer events.SetStore(nil)
+
+	examples := []struct {
+		Url         string
+		Code        int
+		Deployments int
+		P50         float64
+	}{
+		{Url: "/api/v1/teams/Infra/metrics?from=2022-09-01&to=2022-10-01", Code: 200, Deployments: 3, P50: 7200},
+		{Url: "/api/v1/teams/Infra/metrics?from=2022-09-01&to=2022-10-01&environment=staging", Code: 200, Deployments: 1, P50: 60},
+		{Url: "/api/v1/teams/Risk/metrics?from=2022-09-01&to=2022-10-01", Code: 200},
+		{Url: "/api/v1/teams/Infra/metrics?from=yesterday", Code: 400},
+		{Url: "/api/v1/teams/Infra", Code: 404},
+	}
+
+	for _, example := range examples {
+		rec := httptest.NewRecorder()
+		dora.TeamsHandler(rec, httptest.NewRequest(http.MethodGet, example.Url, nil))
+
+		if rec.Code != example.Code {
+			t.Errorf("%s: wanted %d got %d", example.Url, example.Code, rec.Code)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		var got dora.TeamMetricsResponse
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Deployments != example.Deployments || got.LeadTime.P50 != example.P50 {
+			t.Errorf("%s: wanted %d deployments with p50 %v got %+v", example.Url, example.Deployments, example.P50, got)
+		}
+	}
+}
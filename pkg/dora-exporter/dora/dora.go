@@ -0,0 +1,262 @@
+package dora
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+)
+
+var logger log.Logger
+
+func SetLogger(log log.Logger) {
+	logger = log
+	return
+}
+
+// Level is DORA performance level, higher is better
+type Level int
+
+const (
+	NoData Level = iota
+	Low
+	Medium
+	High
+	Elite
+)
+
+var levelNames = map[Level]string{NoData: "no_data", Low: "low", Medium: "medium", High: "high", Elite: "elite"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+func (l Level) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+const day = 24 * time.Hour
+
+// DefaultThresholds returns levels as published in 2023 Accelerate State of DevOps report
+func DefaultThresholds() config.Thresholds {
+	var t config.Thresholds
+	// on demand, between once per day and once per week, between once per week and once per month
+	t.DeploymentFrequency.Elite = 1
+	t.DeploymentFrequency.High = 1.0 / 7
+	t.DeploymentFrequency.Medium = 1.0 / 30
+	// less than one day, between one day and one week, between one week and one month
+	t.LeadTime.Elite = day
+	t.LeadTime.High = 7 * day
+	t.LeadTime.Medium = 30 * day
+	// 5%, 10% and 15% change failure rate
+	t.ChangeFailureRate.Elite = 0.05
+	t.ChangeFailureRate.High = 0.10
+	t.ChangeFailureRate.Medium = 0.15
+	// failed deployment recovery time less than one hour, less than one day, between one day and one week
+	t.TimeToRestore.Elite = time.Hour
+	t.TimeToRestore.High = day
+	t.TimeToRestore.Medium = 7 * day
+	return t
+}
+
+// mergeThresholds replaces zero values of t with defaults
+func mergeThresholds(t config.Thresholds) config.Thresholds {
+	d := DefaultThresholds()
+	orFloat := func(v *float64, def float64) {
+		if *v == 0 {
+			*v = def
+		}
+	}
+	orDuration := func(v *time.Duration, def time.Duration) {
+		if *v == 0 {
+			*v = def
+		}
+	}
+	orFloat(&t.DeploymentFrequency.Elite, d.DeploymentFrequency.Elite)
+	orFloat(&t.DeploymentFrequency.High, d.DeploymentFrequency.High)
+	orFloat(&t.DeploymentFrequency.Medium, d.DeploymentFrequency.Medium)
+	orDuration(&t.LeadTime.Elite, d.LeadTime.Elite)
+	orDuration(&t.LeadTime.High, d.LeadTime.High)
+	orDuration(&t.LeadTime.Medium, d.LeadTime.Medium)
+	orFloat(&t.ChangeFailureRate.Elite, d.ChangeFailureRate.Elite)
+	orFloat(&t.ChangeFailureRate.High, d.ChangeFailureRate.High)
+	orFloat(&t.ChangeFailureRate.Medium, d.ChangeFailureRate.Medium)
+	orDuration(&t.TimeToRestore.Elite, d.TimeToRestore.Elite)
+	orDuration(&t.TimeToRestore.High, d.TimeToRestore.High)
+	orDuration(&t.TimeToRestore.Medium, d.TimeToRestore.Medium)
+	return t
+}
+
+var conf config.Dora
+
+// SetConfig sets measured environment, windows and thresholds
+func SetConfig(c config.Dora) {
+	c.Thresholds = mergeThresholds(c.Thresholds)
+	conf = c
+	level.Info(logger).Log("dora", "config", "environment", conf.Environment, "windows", len(conf.Windows))
+}
+
+// Metrics are the four key metrics computed over a time range
+type Metrics struct {
+	Deployments       int `json:"deployments"`
+	FailedDeployments int `json:"failed_deployments"`
+	// Deployments per day
+	DeploymentFrequency float64 `json:"deployment_frequency"`
+	// Median lead time in seconds
+	LeadTime          float64 `json:"lead_time"`
+	ChangeFailureRate float64 `json:"change_failure_rate"`
+	Incidents         int     `json:"incidents"`
+	ResolvedIncidents int     `json:"resolved_incidents"`
+	// Median time to restore in seconds
+	TimeToRestore float64 `json:"time_to_restore"`
+}
+
+// Levels are performance levels for each of the key metrics,
+// overall level is the lowest level of the metrics having data
+type Levels struct {
+	DeploymentFrequency Level `json:"deployment_frequency"`
+	LeadTime            Level `json:"lead_time"`
+	ChangeFailureRate   Level `json:"change_failure_rate"`
+	TimeToRestore       Level `json:"time_to_restore"`
+	Overall             Level `json:"overall"`
+}
+
+// Finished reports whether deployment reached the final state, successful or failed
+func Finished(deployment events.Event) bool {
+	return deployment.Status == "success" || deployment.Failed
+}
+
+// Compute calculates metrics from deployments and incidents happened between from and to
+func Compute(deployments, incidents []events.Event, from, to time.Time) Metrics {
+	var m Metrics
+
+	for _, d := range deployments {
+		if !Finished(d) {
+			continue
+		}
+		m.Deployments++
+		if d.Failed {
+			m.FailedDeployments++
+		}
+	}
+
+	m.Incidents = len(incidents)
+	restoreTimes := RestoreTimes(incidents)
+	m.ResolvedIncidents = len(restoreTimes)
+
+	if days := to.Sub(from).Hours() / 24; days > 0 {
+		m.DeploymentFrequency = float64(m.Deployments) / days
+	}
+	if m.Deployments > 0 {
+		m.ChangeFailureRate = float64(m.FailedDeployments) / float64(m.Deployments)
+	}
+	m.LeadTime = Percentile(LeadTimes(deployments), 50)
+	m.TimeToRestore = Percentile(restoreTimes, 50)
+
+	return m
+}
+
+// LeadTimes returns lead times of finished deployments in seconds
+func LeadTimes(deployments []events.Event) []float64 {
+	var leadTimes []float64
+	for _, d := range deployments {
+		if Finished(d) && d.LeadTime > 0 {
+			leadTimes = append(leadTimes, d.LeadTime)
+		}
+	}
+	return leadTimes
+}
+
+// RestoreTimes returns restore times of resolved incidents in seconds
+func RestoreTimes(incidents []events.Event) []float64 {
+	var restoreTimes []float64
+	for _, i := range incidents {
+		if i.Resolved != nil {
+			restoreTimes = append(restoreTimes, i.RestoreTime())
+		}
+	}
+	return restoreTimes
+}
+
+// Percentile returns p-th percentile of values using nearest rank, 0 for empty values
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+func higherIsBetter(value, elite, high, medium float64) Level {
+	switch {
+	case value >= elite:
+		return Elite
+	case value >= high:
+		return High
+	case value >= medium:
+		return Medium
+	}
+	return Low
+}
+
+func lowerIsBetter(value, elite, high, medium float64) Level {
+	switch {
+	case value <= elite:
+		return Elite
+	case value <= high:
+		return High
+	case value <= medium:
+		return Medium
+	}
+	return Low
+}
+
+// Classify maps metrics to performance levels using thresholds t
+func Classify(m Metrics, t config.Thresholds) Levels {
+	var l Levels
+
+	if m.Deployments > 0 {
+		l.DeploymentFrequency = higherIsBetter(m.DeploymentFrequency,
+			t.DeploymentFrequency.Elite, t.DeploymentFrequency.High, t.DeploymentFrequency.Medium)
+		l.ChangeFailureRate = lowerIsBetter(m.ChangeFailureRate,
+			t.ChangeFailureRate.Elite, t.ChangeFailureRate.High, t.ChangeFailureRate.Medium)
+	}
+	if m.LeadTime > 0 {
+		l.LeadTime = lowerIsBetter(m.LeadTime,
+			t.LeadTime.Elite.Seconds(), t.LeadTime.High.Seconds(), t.LeadTime.Medium.Seconds())
+	}
+	if m.ResolvedIncidents > 0 {
+		l.TimeToRestore = lowerIsBetter(m.TimeToRestore,
+			t.TimeToRestore.Elite.Seconds(), t.TimeToRestore.High.Seconds(), t.TimeToRestore.Medium.Seconds())
+	}
+
+	for _, metric := range []Level{l.DeploymentFrequency, l.LeadTime, l.ChangeFailureRate, l.TimeToRestore} {
+		if metric != NoData && (l.Overall == NoData || metric < l.Overall) {
+			l.Overall = metric
+		}
+	}
+	return l
+}
+
+// WindowName formats window as label value, e.g. 30d or 12h
+func WindowName(window time.Duration) string {
+	if window%day == 0 {
+		return fmt.Sprintf("%dd", window/day)
+	}
+	return window.String()
+}
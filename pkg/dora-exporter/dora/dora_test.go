@@ -0,0 +1,98 @@
+package dora_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/dora"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+)
+
+var now = time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+
+func deployment(status string, failed bool, leadTime time.Duration) events.Event {
+	return events.Event{Type: events.Deployment, Time: now, Status: status, Failed: failed, LeadTime: leadTime.Seconds()}
+}
+
+func incident(restore time.Duration) events.Event {
+	resolved := now.Add(restore)
+	return events.Event{Type: events.Incident, Time: now, Resolved: &resolved}
+}
+
+func TestCompute(t *testing.T) {
+	deployments := []events.Event{
+		deployment("success", false, 30*time.Minute),
+		deployment("success", false, 2*time.Hour),
+		deployment("success", false, 3*time.Hour),
+		deployment("failure", true, 0),
+		deployment("in_progress", false, time.Hour),
+	}
+	incidents := []events.Event{
+		incident(20 * time.Minute),
+		incident(40 * time.Minute),
+		{Type: events.Incident, Time: now},
+	}
+
+	got := dora.Compute(deployments, incidents, now.Add(-2*24*time.Hour), now)
+
+	if got.Deployments != 4 || got.FailedDeployments != 1 {
+		t.Errorf("Wanted 4 deployments with 1 failed got %d with %d failed", got.Deployments, got.FailedDeployments)
+	}
+	if got.DeploymentFrequency != 2 {
+		t.Errorf("Wanted deployment frequency 2 got %v", got.DeploymentFrequency)
+	}
+	if got.LeadTime != (2 * time.Hour).Seconds() {
+		t.Errorf("Wanted lead time 7200 got %v", got.LeadTime)
+	}
+	if got.ChangeFailureRate != 0.25 {
+		t.Errorf("Wanted change failure rate 0.25 got %v", got.ChangeFailureRate)
+	}
+	if got.Incidents != 3 || got.ResolvedIncidents != 2 || got.TimeToRestore != (20*time.Minute).Seconds() {
+		t.Errorf("Wanted 3 incidents, 2 resolved in 1200 got %+v", got)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	thresholds := dora.DefaultThresholds()
+
+	examples := []struct {
+		Metrics dora.Metrics
+		Want    dora.Levels
+	}{
+		{
+			Metrics: dora.Metrics{Deployments: 60, DeploymentFrequency: 2, LeadTime: 1800, ChangeFailureRate: 0.05, ResolvedIncidents: 1, TimeToRestore: 600},
+			Want:    dora.Levels{DeploymentFrequency: dora.Elite, LeadTime: dora.Elite, ChangeFailureRate: dora.Elite, TimeToRestore: dora.Elite, Overall: dora.Elite},
+		},
+		{
+			Metrics: dora.Metrics{Deployments: 4, DeploymentFrequency: 0.14, LeadTime: 3 * 24 * 3600, ChangeFailureRate: 0.08},
+			Want:    dora.Levels{DeploymentFrequency: dora.Medium, LeadTime: dora.High, ChangeFailureRate: dora.High, Overall: dora.Medium},
+		},
+		{
+			Metrics: dora.Metrics{Deployments: 1, DeploymentFrequency: 0.01, ChangeFailureRate: 1},
+			Want:    dora.Levels{DeploymentFrequency: dora.Low, ChangeFailureRate: dora.Low, Overall: dora.Low},
+		},
+		{
+			// team without deployments
+			Metrics: dora.Metrics{},
+			Want:    dora.Levels{},
+		},
+	}
+
+	for _, example := range examples {
+		got := dora.Classify(example.Metrics, thresholds)
+		if got != example.Want {
+			t.Errorf("Wanted %+v got %+v", example.Want, got)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{5, 1, 4, 2, 3}
+	examples := map[float64]float64{50: 3, 90: 5, 0: 1, 100: 5}
+
+	for p, want := range examples {
+		if got := dora.Percentile(values, p); got != want {
+			t.Errorf("Wanted p%v %v got %v", p, want, got)
+		}
+	}
+}
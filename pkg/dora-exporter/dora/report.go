@@ -0,0 +1,130 @@
+package dora
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type WindowReport struct {
+	Window  string    `json:"window"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Metrics Metrics   `json:"metrics"`
+	Levels  Levels    `json:"levels"`
+}
+
+type TeamReport struct {
+	Team    string         `json:"team"`
+	Windows []WindowReport `json:"windows"`
+}
+
+type Report struct {
+	Environment string       `json:"environment"`
+	Generated   time.Time    `json:"generated"`
+	Teams       []TeamReport `json:"teams"`
+}
+
+// TeamEvents returns stored deployments to environment and incidents of the team between from and to
+func TeamEvents(team, environment string, from, to time.Time) (deployments, incidents []events.Event) {
+	store := events.GetStore()
+	if store == nil {
+		return nil, nil
+	}
+
+	deployments = store.Query(events.Query{
+		Type:        events.Deployment,
+		Team:        team,
+		Environment: environment,
+		Since:       from,
+		Until:       to,
+	})
+	incidents = store.Query(events.Query{
+		Type:  events.Incident,
+		Team:  team,
+		Since: from,
+		Until: to,
+	})
+	return deployments, incidents
+}
+
+// TeamMetrics computes metrics of the team from stored events between from and to
+func TeamMetrics(team string, from, to time.Time) Metrics {
+	deployments, incidents := TeamEvents(team, conf.Environment, from, to)
+	return Compute(deployments, incidents, from, to)
+}
+
+// NewReport classifies every team seen in stored events over configured windows ending at now
+func NewReport(now time.Time) Report {
+	report := Report{Environment: conf.Environment, Generated: now, Teams: []TeamReport{}}
+
+	store := events.GetStore()
+	if store == nil {
+		return report
+	}
+
+	for _, team := range store.Teams() {
+		teamReport := TeamReport{Team: team}
+		for _, window := range conf.Windows {
+			from := now.Add(-window)
+			metrics := TeamMetrics(team, from, now)
+			teamReport.Windows = append(teamReport.Windows, WindowReport{
+				Window:  WindowName(window),
+				From:    from,
+				To:      now,
+				Metrics: metrics,
+				Levels:  Classify(metrics, conf.Thresholds),
+			})
+		}
+		report.Teams = append(report.Teams, teamReport)
+	}
+	return report
+}
+
+func ReportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(NewReport(time.Now()))
+	if err != nil {
+		level.Error(logger).Log("endpoint", "report", "error", err)
+	}
+}
+
+// Collector exposes performance levels computed from stored events on every scrape
+type Collector struct {
+	level *prometheus.Desc
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		level: prometheus.NewDesc(
+			"dora_performance_level",
+			"DORA performance level: 4 elite, 3 high, 2 medium, 1 low, 0 no data.",
+			[]string{"team", "window", "metric"}, nil,
+		),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.level
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, team := range NewReport(time.Now()).Teams {
+		for _, window := range team.Windows {
+			levels := map[string]Level{
+				"deployment_frequency": window.Levels.DeploymentFrequency,
+				"lead_time":            window.Levels.LeadTime,
+				"change_failure_rate":  window.Levels.ChangeFailureRate,
+				"time_to_restore":      window.Levels.TimeToRestore,
+				"overall":              window.Levels.Overall,
+			}
+			for metric, l := range levels {
+				ch <- prometheus.MustNewConstMetric(c.level, prometheus.GaugeValue, float64(l), team.Team, window.Window, metric)
+			}
+		}
+	}
+}
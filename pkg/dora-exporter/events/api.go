@@ -0,0 +1,70 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log/level"
+)
+
+const defaultEventsLimit = 100
+
+// parseSince accepts RFC3339 timestamp, date or duration relative to now, e.g. 24h
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// EventsHandler serves /api/v1/events?type=&team=&repo=&environment=&since=&limit=
+// listing the newest events first
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	since, err := parseSince(query.Get("since"), time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid since: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultEventsLimit
+	if query.Get("limit") != "" {
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	q := Query{
+		Type:        Type(query.Get("type")),
+		Team:        query.Get("team"),
+		Repo:        query.Get("repo"),
+		Environment: query.Get("environment"),
+		Since:       since,
+	}
+
+	result := []Event{}
+	if store != nil {
+		matched := store.Query(q)
+		for i := len(matched) - 1; i >= 0 && len(result) < limit; i-- {
+			result = append(result, matched[i])
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "events", "error", err)
+	}
+}
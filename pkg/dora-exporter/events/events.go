@@ -0,0 +1,285 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+type Type string
+
+const (
+	Deployment Type = "deployment"
+	Incident   Type = "incident"
+)
+
+// Event is a deployment or incident processed by the exporter
+type Event struct {
+	// Source specific identifier, events with the same id are updated in place
+	Id     string `json:"id"`
+	Type   Type   `json:"type"`
+	Source string `json:"source"`
+	// Time when deployment happened or incident was created
+	Time time.Time `json:"time"`
+	Team string    `json:"team"`
+	// Name of the catalog provider which resolved the team
+	Catalog     string `json:"catalog,omitempty"`
+	Repo        string `json:"repo,omitempty"`
+	Project     string `json:"project,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Sha         string `json:"sha,omitempty"`
+	// Released version like a tag
+	Version string `json:"version,omitempty"`
+	// Lead time of the deployed change in seconds
+	LeadTime float64 `json:"lead_time,omitempty"`
+	// Deployment resulted in a failure
+	Failed bool `json:"failed,omitempty"`
+	// Why deployment was attributed as failed change, e.g. incident
+	FailureReason string `json:"failure_reason,omitempty"`
+	// Id of the deployment which caused incident
+	Deployment string `json:"deployment,omitempty"`
+	// How incident was attributed to the deployment: link or heuristic
+	Correlation string `json:"correlation,omitempty"`
+	// Time when incident was resolved
+	Resolved *time.Time `json:"resolved,omitempty"`
+	// Metric labels the event was exported with
+	Labels map[string]string `json:"labels,omitempty"`
+	// Lookup errors happened while processing the event
+	Errors []string `json:"errors,omitempty"`
+}
+
+// RestoreTime returns seconds between incident creation and resolution
+func (e Event) RestoreTime() float64 {
+	if e.Resolved == nil {
+		return 0
+	}
+	return e.Resolved.Sub(e.Time).Seconds()
+}
+
+// Query filters events, empty fields match everything
+type Query struct {
+	Type        Type
+	Team        string
+	Repo        string
+	Environment string
+	Since       time.Time
+	Until       time.Time
+}
+
+func (q Query) Match(e Event) bool {
+	switch {
+	case q.Type != "" && q.Type != e.Type:
+		return false
+	case q.Team != "" && q.Team != e.Team:
+		return false
+	case q.Repo != "" && q.Repo != e.Repo:
+		return false
+	case q.Environment != "" && q.Environment != e.Environment:
+		return false
+	case !q.Since.IsZero() && e.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !e.Time.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// Store keeps events ordered by time and persists them to JSON file
+type Store struct {
+	mu        sync.RWMutex
+	path      string
+	retention time.Duration
+	limit     int
+	events    []Event
+}
+
+var logger log.Logger
+
+func SetLogger(log log.Logger) {
+	logger = log
+	return
+}
+
+var store *Store
+
+func SetStore(s *Store) {
+	store = s
+}
+
+func GetStore() *Store {
+	return store
+}
+
+// NewStore creates store saved to path, events older than retention
+// and the oldest events exceeding limit are dropped. Zero disables the bound.
+func NewStore(path string, retention time.Duration, limit int) *Store {
+	return &Store{path: path, retention: retention, limit: limit}
+}
+
+// Add inserts event or replaces existing one with the same id
+func (s *Store) Add(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.Id != "" {
+		for i := range s.events {
+			if s.events[i].Id == e.Id {
+				s.events = append(s.events[:i], s.events[i+1:]...)
+				break
+			}
+		}
+	}
+
+	i := sort.Search(len(s.events), func(i int) bool { return s.events[i].Time.After(e.Time) })
+	s.events = append(s.events, Event{})
+	copy(s.events[i+1:], s.events[i:])
+	s.events[i] = e
+
+	s.prune()
+}
+
+// Get returns event by id
+func (s *Store) Get(id string) (Event, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, e := range s.events {
+		if e.Id == id {
+			return e, true
+		}
+	}
+	return Event{}, false
+}
+
+// Query returns events matching q ordered by time
+func (s *Store) Query(q Query) []Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []Event
+	for _, e := range s.events {
+		if q.Match(e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Teams returns names of the teams seen in events
+func (s *Store) Teams() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := map[string]bool{}
+	var teams []string
+	for _, e := range s.events {
+		if !seen[e.Team] {
+			seen[e.Team] = true
+			teams = append(teams, e.Team)
+		}
+	}
+	sort.Strings(teams)
+	return teams
+}
+
+func (s *Store) prune() {
+	if s.retention > 0 {
+		cutoff := time.Now().Add(-s.retention)
+		i := sort.Search(len(s.events), func(i int) bool { return !s.events[i].Time.Before(cutoff) })
+		s.events = s.events[i:]
+	}
+	if s.limit > 0 && len(s.events) > s.limit {
+		s.events = s.events[len(s.events)-s.limit:]
+	}
+}
+
+// Load reads events from file, missing file is not an error
+func (s *Store) Load() error {
+	data, err := ioutil.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		level.Info(logger).Log("events", "loader", "file", s.path, "status", "not found")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var loaded []Event
+	err = json.Unmarshal(data, &loaded)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(loaded, func(i, j int) bool { return loaded[i].Time.Before(loaded[j].Time) })
+
+	s.mu.Lock()
+	s.events = loaded
+	s.prune()
+	s.mu.Unlock()
+
+	level.Info(logger).Log("events", "imported", "file", s.path, "count", len(loaded))
+	return nil
+}
+
+// Save writes events to file atomically
+func (s *Store) Save() error {
+	s.mu.RLock()
+	data, err := json.Marshal(s.events)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Record adds event to the configured store
+func Record(e Event) {
+	if store == nil {
+		return
+	}
+	store.Add(e)
+	level.Debug(logger).Log("events", "record", "type", e.Type, "id", e.Id, "team", e.Team)
+}
+
+// Get returns event by id from the configured store
+func Get(id string) (Event, bool) {
+	if store == nil {
+		return Event{}, false
+	}
+	return store.Get(id)
+}
+
+// SaveToFile persists the configured store
+func SaveToFile() {
+	if store == nil {
+		return
+	}
+	err := store.Save()
+	if err != nil {
+		level.Error(logger).Log("events", "save", "file", store.path, "error", err)
+		return
+	}
+	level.Debug(logger).Log("events", "exported", "file", store.path)
+}
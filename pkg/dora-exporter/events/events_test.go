@@ -0,0 +1,126 @@
+package events_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+)
+
+func TestStoreAddAndQuery(t *testing.T) {
+	now := time.Now()
+	store := events.NewStore("", 24*time.Hour, 0)
+
+	store.Add(events.Event{Id: "github/2", Type: events.Deployment, Time: now.Add(-time.Hour), Team: "Infra", Status: "in_progress"})
+	store.Add(events.Event{Id: "github/1", Type: events.Deployment, Time: now.Add(-2 * time.Hour), Team: "Risk", Status: "success"})
+	store.Add(events.Event{Id: "jira/INF-1", Type: events.Incident, Time: now.Add(-30 * time.Minute), Team: "Infra"})
+	// outside of retention
+	store.Add(events.Event{Id: "github/0", Type: events.Deployment, Time: now.Add(-48 * time.Hour), Team: "Infra"})
+	// update of existing deployment
+	store.Add(events.Event{Id: "github/2", Type: events.Deployment, Time: now.Add(-time.Hour), Team: "Infra", Status: "success"})
+
+	all := store.Query(events.Query{})
+	if len(all) != 3 {
+		t.Fatalf("Wanted 3 events got %d", len(all))
+	}
+	if all[0].Id != "github/1" || all[2].Id != "jira/INF-1" {
+		t.Errorf("Wanted events ordered by time got %v", all)
+	}
+
+	deployments := store.Query(events.Query{Type: events.Deployment, Team: "Infra"})
+	if len(deployments) != 1 || deployments[0].Status != "success" {
+		t.Errorf("Wanted updated Infra deployment got %v", deployments)
+	}
+
+	if teams := store.Teams(); len(teams) != 2 || teams[0] != "Infra" {
+		t.Errorf("Wanted Infra and Risk teams got %v", teams)
+	}
+}
+
+func TestStoreSaveLoad(t *testing.T) {
+	events.SetLogger(log.NewLogfmtLogger(os.Stderr))
+	path := filepath.Join(t.TempDir(), "events.json")
+	resolved := time.Now().Truncate(time.Second)
+
+	store := events.NewStore(path, 0, 0)
+	if err := store.Load(); err != nil {
+		t.Fatalf("Wanted missing file to be ignored got %v", err)
+	}
+	store.Add(events.Event{Id: "jira/INF-1", Type: events.Incident, Time: resolved.Add(-time.Hour), Resolved: &resolved})
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := events.NewStore(path, 0, 0)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	incident, ok := loaded.Get("jira/INF-1")
+	if !ok || incident.RestoreTime() != 3600 {
+		t.Errorf("Wanted incident with restore time 3600 got %+v", incident)
+	}
+}
+
+func TestStoreLimit(t *testing.T) {
+	now := time.Now()
+	store := events.NewStore("", 0, 2)
+
+	for i := 0; i < 3; i++ {
+		store.Add(events.Event{Type: events.Deployment, Time: now.Add(time.Duration(i) * time.Minute), Repo: fmt.Sprint(i)})
+	}
+
+	all := store.Query(events.Query{})
+	if len(all) != 2 || all[0].Repo != "1" || all[1].Repo != "2" {
+		t.Errorf("Wanted 2 newest events got %v", all)
+	}
+}
+
+func TestEventsHandler(t *testing.T) {
+	now := time.Now()
+	store := events.NewStore("", 0, 0)
+	store.Add(events.Event{Id: "github/1", Type: events.Deployment, Time: now.Add(-48 * time.Hour), Team: "Infra", Repo: "provisioner"})
+	store.Add(events.Event{Id: "github/2", Type: events.Deployment, Time: now.Add(-2 * time.Hour), Team: "Infra", Repo: "provisioner",
+		Errors: []string{"lead time: commit not found"}})
+	store.Add(events.Event{Id: "github/3", Type: events.Deployment, Time: now.Add(-time.Hour), Team: "Unknown", Repo: "alfred"})
+	store.Add(events.Event{Id: "jira/INF-1", Type: events.Incident, Time: now.Add(-time.Hour), Team: "Infra"})
+	events.SetStore(store)
+	defer events.SetStore(nil)
+
+	examples := map[string][]string{
+		"/api/v1/events": {"jira/INF-1", "github/3", "github/2", "github/1"},
+		"/api/v1/events?type=deployment&team=Infra&since=24h": {"github/2"},
+		"/api/v1/events?repo=provisioner&limit=1":             {"github/2"},
+	}
+
+	for url, want := range examples {
+		rec := httptest.NewRecorder()
+		events.EventsHandler(rec, httptest.NewRequest(http.MethodGet, url, nil))
+
+		var got []events.Event
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatalf("%s: %v", url, err)
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: wanted %v got %v", url, want, got)
+			continue
+		}
+		for i := range want {
+			if got[i].Id != want[i] {
+				t.Errorf("%s: wanted %v got %v", url, want[i], got[i].Id)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	events.EventsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/events?since=yesterday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Wanted 400 for invalid since got %d", rec.Code)
+	}
+}
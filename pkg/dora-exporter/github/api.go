@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-kit/log"
@@ -22,6 +24,12 @@ func SetLogger(log log.Logger) {
 	return
 }
 
+// Page size and maximal amount of pages fetched from paginated endpoints
+const (
+	perPage  = 100
+	maxPages = 10
+)
+
 type GithubApi struct {
 	Owner, Token string
 
@@ -40,6 +48,12 @@ func SetGitHubApi(conf config.Github) {
 	githubApi = GithubApi{BaseUrl: u,
 		Owner: conf.Owner,
 		Token: conf.Token}
+	workflowRules = conf.Workflows
+	releaseRules = conf.Releases
+	incidentLabels = conf.IncidentLabels
+	if conf.DeploymentLabelPrefix != "" {
+		deploymentLabelPrefix = conf.DeploymentLabelPrefix
+	}
 }
 
 func GetGitHubApi() GithubApi {
@@ -47,17 +61,21 @@ func GetGitHubApi() GithubApi {
 }
 
 func (api GithubApi) Fetch(path string) ([]byte, error) {
+	return api.FetchQuery(path, nil)
+}
+
+func (api GithubApi) FetchQuery(path string, query url.Values) ([]byte, error) {
 	url := url.URL{Scheme: api.BaseUrl.Scheme,
-		Host: api.BaseUrl.Host,
-		Path: path,
+		Host:     api.BaseUrl.Host,
+		Path:     path,
+		RawQuery: query.Encode(),
 	}
 
 	req, err := http.NewRequest(http.MethodGet, url.String(), http.NoBody)
-	req.Header.Add("Authorization", "token "+api.Token)
-
 	if err != nil {
-		level.Error(logger).Log(err)
+		return nil, err
 	}
+	req.Header.Add("Authorization", "token "+api.Token)
 
 	client := http.Client{Timeout: 15 * time.Second}
 
@@ -66,12 +84,57 @@ func (api GithubApi) Fetch(path string) ([]byte, error) {
 	level.Debug(logger).Log("component", "github_api", "call", url.String())
 
 	if err != nil {
-		level.Error(logger).Log(err)
+		return nil, err
 	}
 
 	defer resp.Body.Close()
 
-	return io.ReadAll(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, StatusError{Path: path, Status: resp.Status, StatusCode: resp.StatusCode}
+	}
+
+	return body, nil
+}
+
+// FetchAll requests pages of path until a page isn't full, at most maxPages are fetched.
+// page decodes the response and returns the amount of items in it.
+func (api GithubApi) FetchAll(path string, page func([]byte) (int, error)) error {
+	for i := 1; i <= maxPages; i++ {
+		resBody, err := api.FetchQuery(path, url.Values{"per_page": {strconv.Itoa(perPage)}, "page": {strconv.Itoa(i)}})
+		if err != nil {
+			return err
+		}
+		items, err := page(resBody)
+		if err != nil {
+			return err
+		}
+		if items < perPage {
+			return nil
+		}
+	}
+	return nil
+}
+
+// StatusError is returned when GitHub API responds with unsuccessful status
+type StatusError struct {
+	Path       string
+	Status     string
+	StatusCode int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("github: %s returned %s", e.Path, e.Status)
+}
+
+// IsNotFound reports whether err is GitHub API 404 response
+func IsNotFound(err error) bool {
+	var statusErr StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
 }
 
 type Author struct {
@@ -91,33 +154,55 @@ type PullRequest struct {
 }
 
 // https://api.github.com/repos/{{owner}}/{{repo}}/pulls/{{pull_number}}/commits
-func (api GithubApi) PullRequestInfo(repo string, pullRequestNumber string) []PullRequest {
+func (api GithubApi) PullRequestInfo(repo string, pullRequestNumber string) ([]PullRequest, error) {
 	var pullRequests []PullRequest
-	resBody, _ := api.Fetch(fmt.Sprintf("/repos/%s/%s/pulls/%s/commits", api.Owner, repo, pullRequestNumber))
+	resBody, err := api.Fetch(fmt.Sprintf("/repos/%s/%s/pulls/%s/commits", api.Owner, repo, pullRequestNumber))
+	if err != nil {
+		return nil, err
+	}
 
-	err := json.Unmarshal([]byte(resBody), &pullRequests)
+	err = json.Unmarshal([]byte(resBody), &pullRequests)
 	if err != nil {
-		level.Error(logger).Log(err)
+		return nil, err
 	}
 
 	level.Debug(logger).Log("component", "github_api", "repo", repo, "pull_request", pullRequestNumber)
 
-	return pullRequests
+	return pullRequests, nil
+}
+
+// https://api.github.com/repos/{{owner}}/{{repo}}/issues/{{pull_number}}/labels
+func (api GithubApi) PullRequestLabels(repo string, pullRequestNumber string) ([]string, error) {
+	var labels []Label
+	resBody, err := api.Fetch(fmt.Sprintf("/repos/%s/%s/issues/%s/labels", api.Owner, repo, pullRequestNumber))
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(resBody, &labels)
+	names := make([]string, 0, len(labels))
+	for _, label := range labels {
+		names = append(names, label.Name)
+	}
+	return names, err
 }
 
 // https://api.github.com/repos/{{owner}}/{{repo}}/git/commits/{{commit_sha}}
-func (api GithubApi) CommitInfo(repo string, sha string) Commit {
+func (api GithubApi) CommitInfo(repo string, sha string) (Commit, error) {
 	var commit Commit
-	resBody, _ := api.Fetch(fmt.Sprintf("/repos/%s/%s/git/commits/%s", api.Owner, repo, sha))
+	resBody, err := api.Fetch(fmt.Sprintf("/repos/%s/%s/git/commits/%s", api.Owner, repo, sha))
+	if err != nil {
+		return commit, err
+	}
 
-	err := json.Unmarshal([]byte(resBody), &commit)
+	err = json.Unmarshal([]byte(resBody), &commit)
 	if err != nil {
-		level.Error(logger).Log(err)
+		return commit, err
 	}
 
 	level.Debug(logger).Log("component", "github_api", "repo", repo, "commit_info", sha)
 
-	return commit
+	return commit, nil
 }
 
 // BETA-136: ticket notification log no exception (#12)
@@ -134,18 +219,159 @@ func (commit Commit) PullRequestId() (string, error) {
 }
 
 func (api GithubApi) FindFirstCommitDate(repo, sha string) time.Time {
-	commit := api.CommitInfo(repo, sha)
+	date, _, err := api.FindFirstCommit(repo, sha)
+	if err != nil {
+		level.Error(logger).Log("repo", repo, "sha", sha, "error", err)
+	}
+	return date
+}
+
+// FindFirstCommit returns the first commit date and related pull request number,
+// pull request is empty when commit has no associated PR
+func (api GithubApi) FindFirstCommit(repo, sha string) (time.Time, string, error) {
+	commit, err := api.CommitInfo(repo, sha)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("commit %s: %w", sha, err)
+	}
 	prId, err := commit.PullRequestId()
 
 	if err != nil {
 
 		level.Debug(logger).Log("repo", repo, "sha", sha, "date", "current_commit")
 		// no pull request associated
-		return commit.Author.Date
+		return commit.Author.Date, "", nil
 	}
 
-	prInfo := api.PullRequestInfo(repo, prId)
+	prInfo, err := api.PullRequestInfo(repo, prId)
+	if err != nil {
+		return commit.Author.Date, prId, fmt.Errorf("pull request %s: %w", prId, err)
+	}
+	if len(prInfo) == 0 {
+		return commit.Author.Date, prId, fmt.Errorf("pull request %s: no commits", prId)
+	}
 
 	level.Debug(logger).Log("repo", repo, "sha", sha, "PR", prId, "date", "pr_first_commit")
-	return prInfo[0].Commit.Author.Date
+	return prInfo[0].Commit.Author.Date, prId, nil
+}
+
+// FindRepositoryFirstCommit is FindFirstCommit accepting repository either by name or full name with owner
+func (api GithubApi) FindRepositoryFirstCommit(repository, sha string) (time.Time, string, error) {
+	if owner, repo, ok := strings.Cut(repository, "/"); ok {
+		api.Owner = owner
+		repository = repo
+	}
+	return api.FindFirstCommit(repository, sha)
+}
+
+type Release struct {
+	Id          int
+	TagName     string `json:"tag_name"`
+	Draft       bool
+	Prerelease  bool
+	PublishedAt time.Time `json:"published_at"`
+	HtmlUrl     string    `json:"html_url"`
+}
+
+// https://api.github.com/repos/{{owner}}/{{repo}}/releases
+func (api GithubApi) Releases(repo string) ([]Release, error) {
+	var releases []Release
+	err := api.FetchAll(fmt.Sprintf("/repos/%s/%s/releases", api.Owner, repo), func(resBody []byte) (int, error) {
+		var page []Release
+		err := json.Unmarshal(resBody, &page)
+		releases = append(releases, page...)
+		return len(page), err
+	})
+	return releases, err
+}
+
+type Tag struct {
+	Name   string
+	Commit struct {
+		Sha string
+	}
+}
+
+// https://api.github.com/repos/{{owner}}/{{repo}}/tags
+func (api GithubApi) Tags(repo string) ([]Tag, error) {
+	var tags []Tag
+	err := api.FetchAll(fmt.Sprintf("/repos/%s/%s/tags", api.Owner, repo), func(resBody []byte) (int, error) {
+		var page []Tag
+		err := json.Unmarshal(resBody, &page)
+		tags = append(tags, page...)
+		return len(page), err
+	})
+	return tags, err
+}
+
+// RefSha returns sha of the commit the ref like a tag points to
+// https://api.github.com/repos/{{owner}}/{{repo}}/commits/{{ref}}
+func (api GithubApi) RefSha(repo, ref string) (string, error) {
+	var commit struct {
+		Sha string
+	}
+	resBody, err := api.Fetch(fmt.Sprintf("/repos/%s/%s/commits/%s", api.Owner, repo, ref))
+	if err != nil {
+		return "", err
+	}
+
+	err = json.Unmarshal(resBody, &commit)
+	return commit.Sha, err
+}
+
+type Comparison struct {
+	// ahead, behind, identical or diverged head relative to base
+	Status       string
+	TotalCommits int `json:"total_commits"`
+	Commits      []PullRequest
+}
+
+// https://api.github.com/repos/{{owner}}/{{repo}}/compare/{{base}}...{{head}}
+func (api GithubApi) Compare(repo, base, head string) (Comparison, error) {
+	var comparison Comparison
+	resBody, err := api.Fetch(fmt.Sprintf("/repos/%s/%s/compare/%s...%s", api.Owner, repo, base, head))
+	if err != nil {
+		return comparison, err
+	}
+
+	err = json.Unmarshal(resBody, &comparison)
+	return comparison, err
+}
+
+// IsAncestor reports whether ancestor commit is reachable from sha, repository is either name or full name with owner
+func (api GithubApi) IsAncestor(repository, ancestor, sha string) (bool, error) {
+	if owner, repo, ok := strings.Cut(repository, "/"); ok {
+		api.Owner = owner
+		repository = repo
+	}
+	comparison, err := api.Compare(repository, sha, ancestor)
+	if err != nil {
+		return false, fmt.Errorf("compare %s...%s: %w", sha, ancestor, err)
+	}
+	return comparison.Status == "behind" || comparison.Status == "identical", nil
+}
+
+// FindReleaseFirstCommit returns the oldest commit date among commits between previous and head refs
+// and the number of commits, falls back to FindFirstCommit of sha without previous release
+func (api GithubApi) FindReleaseFirstCommit(repo, previous, head, sha string) (time.Time, int, error) {
+	if previous == "" {
+		date, _, err := api.FindFirstCommit(repo, sha)
+		return date, 1, err
+	}
+
+	comparison, err := api.Compare(repo, previous, head)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("compare %s...%s: %w", previous, head, err)
+	}
+	if len(comparison.Commits) == 0 {
+		return time.Time{}, 0, fmt.Errorf("compare %s...%s: no commits", previous, head)
+	}
+
+	first := comparison.Commits[0].Commit.Author.Date
+	for _, commit := range comparison.Commits {
+		if commit.Commit.Author.Date.Before(first) {
+			first = commit.Commit.Author.Date
+		}
+	}
+	level.Debug(logger).Log("repo", repo, "previous", previous, "head", head, "commits", comparison.TotalCommits, "date", "release_first_commit")
+	return first, comparison.TotalCommits, nil
 }
@@ -0,0 +1,236 @@
+package github
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+)
+
+const defaultOwnersTTL = time.Hour
+
+// Failed lookups are cached shortly, so unreachable API isn't requested on every event
+const failedOwnersTTL = time.Minute
+
+// Locations of CODEOWNERS file in order GitHub looks for it
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// Repository permissions from the highest
+var permissionRanks = map[string]int{"admin": 5, "maintain": 4, "push": 3, "triage": 2, "pull": 1}
+
+type cachedOwner struct {
+	team    string
+	expires time.Time
+}
+
+// ownersCache keeps resolved owners of repositories for ttl, failed lookups for failedOwnersTTL at most
+type ownersCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cachedOwner
+}
+
+func newOwnersCache(ttl time.Duration) *ownersCache {
+	if ttl == 0 {
+		ttl = defaultOwnersTTL
+	}
+	return &ownersCache{ttl: ttl, entries: map[string]cachedOwner{}}
+}
+
+func (c *ownersCache) get(repository string, resolve func() (string, error)) string {
+	key := strings.ToLower(repository)
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.team
+	}
+
+	ttl := c.ttl
+	team, err := resolve()
+	if err != nil {
+		level.Error(logger).Log("catalog", "github", "repository", repository, "error", err)
+		team = catalog.UnknownTeam
+		if ttl > failedOwnersTTL {
+			ttl = failedOwnersTTL
+		}
+	}
+
+	c.mu.Lock()
+	c.entries[key] = cachedOwner{team: team, expires: time.Now().Add(ttl)}
+	c.mu.Unlock()
+	return team
+}
+
+// fullName prefixes repository name with the configured owner when it has no owner
+func (api GithubApi) fullName(repository string) string {
+	if strings.Contains(repository, "/") {
+		return repository
+	}
+	return api.Owner + "/" + repository
+}
+
+type contents struct {
+	Content  string
+	Encoding string
+}
+
+// Codeowners returns content of the repository CODEOWNERS file, empty when repository has none
+func (api GithubApi) Codeowners(repository string) (string, error) {
+	for _, path := range codeownersPaths {
+		resBody, err := api.Fetch(fmt.Sprintf("/repos/%s/contents/%s", api.fullName(repository), path))
+		if IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("codeowners: %w", err)
+		}
+
+		var file contents
+		if err = json.Unmarshal(resBody, &file); err != nil {
+			return "", err
+		}
+		if file.Encoding != "base64" {
+			return file.Content, nil
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(file.Content, "\n", ""))
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return "", nil
+}
+
+// ParseCodeowners returns the first team owning the whole repository,
+// which is the last rule for * or /, or the first rule with a team owner otherwise.
+// Teams are referenced as @org/team-slug, users and emails are skipped.
+func ParseCodeowners(content string) string {
+	var catchAll, first string
+
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		var team string
+		for _, owner := range fields[1:] {
+			if strings.HasPrefix(owner, "@") && strings.Contains(owner, "/") {
+				team = owner[strings.Index(owner, "/")+1:]
+				break
+			}
+		}
+		if team == "" {
+			continue
+		}
+
+		if first == "" {
+			first = team
+		}
+		switch fields[0] {
+		case "*", "/", "/*", "/**":
+			catchAll = team
+		}
+	}
+
+	switch {
+	case catchAll != "":
+		return catchAll
+	case first != "":
+		return first
+	}
+	return catalog.UnknownTeam
+}
+
+// CodeownersCatalog resolves repository owner from its CODEOWNERS file
+type CodeownersCatalog struct {
+	Api   GithubApi
+	cache *ownersCache
+}
+
+func NewCodeownersCatalog(api GithubApi, ttl time.Duration) *CodeownersCatalog {
+	level.Info(logger).Log("catalog", "codeowners", "owner", api.Owner)
+	return &CodeownersCatalog{Api: api, cache: newOwnersCache(ttl)}
+}
+
+func (c *CodeownersCatalog) GetTeamNameByRepository(repository string) string {
+	repository = c.Api.fullName(repository)
+	return c.cache.get(repository, func() (string, error) {
+		content, err := c.Api.Codeowners(repository)
+		if err != nil {
+			return "", err
+		}
+		return ParseCodeowners(content), nil
+	})
+}
+
+// GetTeamNameByProject is unknown, CODEOWNERS has no Jira projects
+func (c *CodeownersCatalog) GetTeamNameByProject(project string) string {
+	return catalog.UnknownTeam
+}
+
+type RepositoryTeam struct {
+	Name       string
+	Slug       string
+	Permission string
+}
+
+// https://api.github.com/repos/{{owner}}/{{repo}}/teams
+func (api GithubApi) RepositoryTeams(repository string) ([]RepositoryTeam, error) {
+	var teams []RepositoryTeam
+	err := api.FetchAll(fmt.Sprintf("/repos/%s/teams", api.fullName(repository)), func(resBody []byte) (int, error) {
+		var page []RepositoryTeam
+		err := json.Unmarshal(resBody, &page)
+		teams = append(teams, page...)
+		return len(page), err
+	})
+	return teams, err
+}
+
+// OwningTeam returns slug of the team with the highest permission, the first one listed wins ties
+func OwningTeam(teams []RepositoryTeam) string {
+	owner, rank := catalog.UnknownTeam, 0
+	for _, team := range teams {
+		if permissionRanks[team.Permission] > rank {
+			owner, rank = team.Slug, permissionRanks[team.Permission]
+		}
+	}
+	return owner
+}
+
+// TeamsCatalog resolves repository owner from GitHub teams having access to the repository
+type TeamsCatalog struct {
+	Api   GithubApi
+	cache *ownersCache
+}
+
+func NewTeamsCatalog(api GithubApi, ttl time.Duration) *TeamsCatalog {
+	level.Info(logger).Log("catalog", "github_teams", "owner", api.Owner)
+	return &TeamsCatalog{Api: api, cache: newOwnersCache(ttl)}
+}
+
+func (c *TeamsCatalog) GetTeamNameByRepository(repository string) string {
+	repository = c.Api.fullName(repository)
+	return c.cache.get(repository, func() (string, error) {
+		teams, err := c.Api.RepositoryTeams(repository)
+		if err != nil {
+			return "", err
+		}
+		return OwningTeam(teams), nil
+	})
+}
+
+// GetTeamNameByProject is unknown, GitHub teams have no Jira projects
+func (c *TeamsCatalog) GetTeamNameByProject(project string) string {
+	return catalog.UnknownTeam
+}
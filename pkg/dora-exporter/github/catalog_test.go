@@ -0,0 +1,135 @@
+package github_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/github"
+)
+
+func TestParseCodeowners(t *testing.T) {
+	examples := map[string]string{
+		"# owners\n*.go @acme/backend\n* @acme/platform @jdoe\n/docs/ @acme/writers\n": "platform",
+		"/src/ @jdoe @acme/payments # backend\n/web/ @acme/frontend\n":                 "payments",
+		"* @jdoe user@example.com\n":                                                   catalog.UnknownTeam,
+		"":                                                                             catalog.UnknownTeam,
+	}
+
+	for content, want := range examples {
+		if got := github.ParseCodeowners(content); got != want {
+			t.Errorf("Wanted %s got %s for %q", want, got, content)
+		}
+	}
+}
+
+func TestOwningTeam(t *testing.T) {
+	teams := []github.RepositoryTeam{
+		{Slug: "readers", Permission: "pull"},
+		{Slug: "payments", Permission: "admin"},
+		{Slug: "platform", Permission: "admin"},
+	}
+	if got := github.OwningTeam(teams); got != "payments" {
+		t.Errorf("Wanted payments got %s", got)
+	}
+	if got := github.OwningTeam(nil); got != catalog.UnknownTeam {
+		t.Errorf("Wanted %s got %s", catalog.UnknownTeam, got)
+	}
+}
+
+func githubServer(t *testing.T, calls *int32) github.GithubApi {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		switch r.URL.Path {
+		case "/repos/acme/billing/contents/CODEOWNERS":
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"encoding": "base64",
+				"content":  base64.StdEncoding.EncodeToString([]byte("* @acme/payments\n")),
+			})
+		case "/repos/acme/billing/teams":
+			_ = json.NewEncoder(w).Encode([]map[string]string{
+				{"slug": "readers", "permission": "pull"},
+				{"slug": "payments", "permission": "maintain"},
+			})
+		case "/repos/acme/monorepo/teams":
+			// the owner is listed on the second page
+			teams := []map[string]string{{"slug": "platform", "permission": "admin"}}
+			if r.URL.Query().Get("page") == "1" {
+				teams = nil
+				for i := 0; i < 100; i++ {
+					teams = append(teams, map[string]string{"slug": fmt.Sprintf("readers-%d", i), "permission": "pull"})
+				}
+			}
+			_ = json.NewEncoder(w).Encode(teams)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	u, _ := url.Parse(server.URL)
+	return github.GithubApi{Owner: "acme", Token: "secret", BaseUrl: *u}
+}
+
+func TestCodeownersCatalog(t *testing.T) {
+	github.SetLogger(log.NewLogfmtLogger(os.Stderr))
+	catalog.SetLogger(log.NewNopLogger())
+	var calls int32
+
+	codeowners := github.NewCodeownersCatalog(githubServer(t, &calls), time.Minute)
+	static := catalog.NewCatalogFromYaml("- name: Infra\n  github_repositories:\n    - acme/provisioner\n")
+	chain := catalog.NewComposite(
+		catalog.Provider{Name: "codeowners", Catalog: codeowners},
+		catalog.Provider{Name: "static", Catalog: static},
+	)
+
+	if got := chain.GetTeamNameByRepository("billing"); got != "payments" {
+		t.Errorf("Wanted payments got %s", got)
+	}
+	// CODEOWNERS lookup is cached
+	before := atomic.LoadInt32(&calls)
+	if got := chain.GetTeamNameByRepository("acme/billing"); got != "payments" {
+		t.Errorf("Wanted payments got %s", got)
+	}
+	if atomic.LoadInt32(&calls) != before {
+		t.Errorf("Wanted cached owner")
+	}
+	// repository without CODEOWNERS is resolved by the next provider
+	if got := chain.GetTeamNameByRepository("acme/provisioner"); got != "Infra" {
+		t.Errorf("Wanted Infra got %s", got)
+	}
+}
+
+func TestTeamsCatalog(t *testing.T) {
+	github.SetLogger(log.NewLogfmtLogger(os.Stderr))
+	var calls int32
+
+	teams := github.NewTeamsCatalog(githubServer(t, &calls), time.Minute)
+
+	if got := teams.GetTeamNameByRepository("acme/billing"); got != "payments" {
+		t.Errorf("Wanted payments got %s", got)
+	}
+	if got := teams.GetTeamNameByRepository("acme/monorepo"); got != "platform" {
+		t.Errorf("Wanted platform got %s", got)
+	}
+	if got := teams.GetTeamNameByRepository("acme/unknown"); got != catalog.UnknownTeam {
+		t.Errorf("Wanted %s got %s", catalog.UnknownTeam, got)
+	}
+	// failed lookup is cached too
+	before := atomic.LoadInt32(&calls)
+	if got := teams.GetTeamNameByRepository("acme/unknown"); got != catalog.UnknownTeam {
+		t.Errorf("Wanted %s got %s", catalog.UnknownTeam, got)
+	}
+	if atomic.LoadInt32(&calls) != before {
+		t.Errorf("Wanted cached failed lookup")
+	}
+}
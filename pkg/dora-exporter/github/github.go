@@ -2,18 +2,21 @@ package github
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/go-kit/log/level"
 	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
 	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
-	"github.com/prometheus/client_golang/prometheus"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 type Deployment_Status struct {
-	State string
-	Url   string
-	Id    int
+	State      string
+	Url        string
+	Id         int
+	Created_At time.Time
 }
 
 type Deployment struct {
@@ -44,13 +47,6 @@ type GitHubWebhookPayload struct {
 	Sender            Sender
 }
 
-var teams catalog.Teams
-
-func SetTeams(t catalog.Teams) {
-	teams = t
-	return
-}
-
 var cat catalog.TeamsCatalog
 
 func SetCatalog(catalog catalog.TeamsCatalog) {
@@ -58,21 +54,66 @@ func SetCatalog(catalog catalog.TeamsCatalog) {
 	level.Info(logger).Log("github", "catalog service set")
 }
 
-// GetPullRequestDuration returns duration between current time
-// and first commit found either from commit itself or from associated PR
-func (payload GitHubWebhookPayload) GetCommitDuration() float64 {
-	firstCommitDate := githubApi.FindFirstCommitDate(payload.Repository.Name, payload.Deployment.Sha)
+// GetCommitDuration returns duration between current time
+// and first commit found either from commit itself or from associated PR,
+// along with the associated PR number
+func (payload GitHubWebhookPayload) GetCommitDuration() (float64, string, error) {
+	firstCommitDate, pullRequest, err := githubApi.FindFirstCommit(payload.Repository.Name, payload.Deployment.Sha)
+	if err != nil {
+		return 0, pullRequest, err
+	}
 
 	level.Debug(logger).Log("commit_duration", time.Since(firstCommitDate))
 
-	return time.Since(firstCommitDate).Seconds()
+	return time.Since(firstCommitDate).Seconds(), pullRequest, nil
+}
+
+// GetEventTime returns the time deployment status was created, falls back to current time
+func (payload GitHubWebhookPayload) GetEventTime() time.Time {
+	if payload.Deployment_Status.Created_At.IsZero() {
+		return time.Now()
+	}
+	return payload.Deployment_Status.Created_At
+}
+
+// pullRequestLabels returns labels of the deployed pull request when hotfixes are selected by labels
+func pullRequestLabels(repo, pullRequest string) []string {
+	if pullRequest == "" || !tracker.HotfixLabels() {
+		return nil
+	}
+	labels, err := githubApi.PullRequestLabels(repo, pullRequest)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "github", "repository", repo, "pull_request", pullRequest, "labels", "error", err)
+	}
+	return labels
+}
+
+// Failed reports whether deployment status is failure or error
+func (payload GitHubWebhookPayload) Failed() bool {
+	return payload.Deployment_Status.State == "failure" || payload.Deployment_Status.State == "error"
 }
 
 func GithubAPIHandler(w http.ResponseWriter, r *http.Request) {
 	var payload GitHubWebhookPayload
 	var duration float64
+	var pullRequest string
+	var lookupErrors []string
 
-	if r.Header.Get("X-GitHub-Event") != "deployment_status" {
+	switch r.Header.Get("X-GitHub-Event") {
+	case "deployment_status":
+	case "workflow_run":
+		workflowRunHandler(w, r)
+		return
+	case "release":
+		releaseHandler(w, r)
+		return
+	case "push":
+		tagPushHandler(w, r)
+		return
+	case "issues":
+		issuesHandler(w, r)
+		return
+	default:
 		w.WriteHeader(202)
 		return
 	}
@@ -85,23 +126,47 @@ func GithubAPIHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	labels := prometheus.Labels{
-		"repo":        payload.Repository.Name,
-		"environment": payload.Deployment.Environment,
-		"team":        cat.GetTeamNameByRepository(payload.Repository.Full_Name),
-		"status":      payload.Deployment_Status.State,
+	team, provider := catalog.ResolveRepository(cat, payload.Repository.Full_Name)
+	if team == catalog.UnknownTeam {
+		lookupErrors = append(lookupErrors, "catalog: no team for repository "+payload.Repository.Full_Name)
 	}
 
-	duration = payload.GetCommitDuration()
+	duration, pullRequest, err = payload.GetCommitDuration()
+	if err != nil {
+		level.Error(logger).Log("endpoint", "github", "repository", payload.Repository.Name, "sha", payload.Deployment.Sha, "error", err)
+		lookupErrors = append(lookupErrors, "lead time: "+err.Error())
+	}
 
-	prom.IncDeploymentsCount(labels)
-	prom.AddDeploymentsDuration(labels, duration)
+	// labels matter only for deployed changes
+	var changeLabels []string
+	if payload.Deployment_Status.State == "success" {
+		changeLabels = pullRequestLabels(payload.Repository.Name, pullRequest)
+	}
 
-	level.Info(logger).Log(
-		"endpoint", "github",
-		"environment", labels["environment"],
-		"repository", labels["repo"],
-		"status", labels["status"],
-		"team", labels["team"],
-		"sha", payload.Deployment.Sha)
+	tracker.RecordDeployment(tracker.Deployment{
+		Id:          fmt.Sprintf("github/%d", payload.Deployment.Id),
+		Source:      "github",
+		Time:        payload.GetEventTime(),
+		Repo:        payload.Repository.Name,
+		Environment: payload.Deployment.Environment,
+		Team:        team,
+		Catalog:     provider,
+		Status:      payload.Deployment_Status.State,
+		Sha:         payload.Deployment.Sha,
+		LeadTime:    duration,
+		// lead time is unknown when lookup failed
+		HasLeadTime:  err == nil,
+		Failed:       payload.Failed(),
+		Ref:          payload.Deployment.Ref,
+		ChangeLabels: changeLabels,
+		Provider:     "github",
+		Repository:   payload.Repository.Full_Name,
+		Exemplar: prom.NewExemplar(
+			"deployment_url", payload.Deployment.Url,
+			"sha", payload.Deployment.Sha,
+			"deployment_id", strconv.Itoa(payload.Deployment.Id),
+			"pull_request", pullRequest,
+		),
+		Errors: lookupErrors,
+	})
 }
@@ -0,0 +1,110 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
+)
+
+var (
+	incidentLabels        []string
+	deploymentLabelPrefix = "deployment:"
+)
+
+type Label struct {
+	Name string
+}
+
+type Issue struct {
+	Number int
+	Title  string
+	// open or closed
+	State     string
+	Labels    []Label
+	HtmlUrl   string    `json:"html_url"`
+	CreatedAt time.Time `json:"created_at"`
+	ClosedAt  time.Time `json:"closed_at"`
+}
+
+type IssuesPayload struct {
+	// opened, labeled, closed, reopened...
+	Action     string
+	Issue      Issue
+	Repository Repository
+}
+
+// IsIncident reports whether issue has any of the labels, case insensitive
+func (issue Issue) IsIncident(labels []string) bool {
+	for _, label := range issue.Labels {
+		for _, incidentLabel := range labels {
+			if strings.EqualFold(label.Name, incidentLabel) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DeploymentLinks returns deployment ids, SHAs or versions from prefixed labels like deployment:v1.2.0
+func (issue Issue) DeploymentLinks() []string {
+	var links []string
+	for _, label := range issue.Labels {
+		if strings.HasPrefix(label.Name, deploymentLabelPrefix) {
+			links = append(links, strings.TrimPrefix(label.Name, deploymentLabelPrefix))
+		}
+	}
+	return links
+}
+
+// NewIncident maps issue to the owner of its repository, closed issue is resolved
+func (payload IssuesPayload) NewIncident() tracker.Incident {
+	issue := payload.Issue
+	i := tracker.Incident{
+		Id:      fmt.Sprintf("github/issue/%s/%d", payload.Repository.Full_Name, issue.Number),
+		Source:  "github",
+		Time:    issue.CreatedAt,
+		Project: payload.Repository.Name,
+		Status:  issue.State,
+		Links:   issue.DeploymentLinks(),
+	}
+	i.Team, i.Catalog = catalog.ResolveRepository(cat, payload.Repository.Full_Name)
+	if i.Time.IsZero() {
+		i.Time = time.Now()
+	}
+	if i.Team == catalog.UnknownTeam {
+		i.Errors = append(i.Errors, "catalog: no team for repository "+payload.Repository.Full_Name)
+	}
+	if issue.State == "closed" {
+		i.Resolved = issue.ClosedAt
+		if i.Resolved.IsZero() {
+			i.Resolved = time.Now()
+		}
+	}
+	return i
+}
+
+// issuesHandler records issues labeled as incidents
+func issuesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload IssuesPayload
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "github", "event", "issues", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !payload.Issue.IsIncident(incidentLabels) {
+		level.Debug(logger).Log("endpoint", "github", "event", "issues", "repository", payload.Repository.Full_Name, "issue", payload.Issue.Number, "incident", false)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	tracker.RecordIncident(payload.NewIncident())
+}
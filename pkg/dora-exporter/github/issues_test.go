@@ -0,0 +1,104 @@
+package github_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/github"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/internal/testenv"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func issue(action, state, label string, closedAt time.Time) string {
+	body, _ := json.Marshal(github.IssuesPayload{
+		Action: action,
+		Issue: github.Issue{
+			Number:    12,
+			State:     state,
+			Labels:    []github.Label{{Name: "bug"}, {Name: label}},
+			CreatedAt: time.Date(2021, 4, 28, 10, 0, 0, 0, time.UTC),
+			ClosedAt:  closedAt,
+		},
+		Repository: github.Repository{Name: "payments", Full_Name: "acme/payments"},
+	})
+	return string(body)
+}
+
+func setupIssues(t *testing.T, labels ...string) (*events.Store, *prom.Exporter) {
+	store, exporter := testenv.Setup(t, github.SetLogger)
+	github.SetGitHubApi(config.Github{Owner: "acme", IncidentLabels: labels})
+	github.SetCatalog(catalog.NewCatalogFromYaml("- name: Payments\n  github_repositories: [acme/payments]\n"))
+	return store, exporter
+}
+
+func postIssue(body string) int {
+	return testenv.Post(github.GithubAPIHandler, "/api/github", body, "X-GitHub-Event", "issues").Code
+}
+
+func TestIssuesIncidents(t *testing.T) {
+	store, exporter := setupIssues(t, "incident", "outage")
+
+	examples := []struct {
+		Name     string
+		Action   string
+		State    string
+		Label    string
+		ClosedAt time.Time
+		Status   int
+		Resolved bool
+	}{
+		{Name: "without incident label", Action: "opened", State: "open", Label: "enhancement", Status: http.StatusAccepted},
+		{Name: "labeled", Action: "labeled", State: "open", Label: "Outage", Status: http.StatusOK},
+		{Name: "closed", Action: "closed", State: "closed", Label: "outage", ClosedAt: time.Date(2021, 4, 28, 13, 30, 0, 0, time.UTC), Status: http.StatusOK, Resolved: true},
+	}
+	for _, example := range examples {
+		if code := postIssue(issue(example.Action, example.State, example.Label, example.ClosedAt)); code != example.Status {
+			t.Fatalf("%s: wanted %d got %d", example.Name, example.Status, code)
+		}
+		if e, ok := store.Get("github/issue/acme/payments/12"); ok && (e.Resolved != nil) != example.Resolved {
+			t.Errorf("%s: wanted resolved %v got %+v", example.Name, example.Resolved, e)
+		}
+	}
+
+	e, ok := store.Get("github/issue/acme/payments/12")
+	if !ok || e.Team != "Payments" || e.Project != "payments" || e.Status != "closed" || e.RestoreTime() != (3*time.Hour+30*time.Minute).Seconds() {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	payments := prometheus.Labels{"project": "payments", "team": "Payments"}
+	if got := testenv.Value(t, exporter, "jira_incidents", payments); got != 1 {
+		t.Errorf("Wanted 1 incident got %v", got)
+	}
+	if got := testenv.Value(t, exporter, "jira_incidents_duration_sum", payments); got != (3*time.Hour + 30*time.Minute).Seconds() {
+		t.Errorf("Wanted 3h30m restore time got %v", got)
+	}
+}
+
+func TestIssuesWithoutIncidentLabels(t *testing.T) {
+	store, exporter := setupIssues(t)
+
+	if code := postIssue(issue("labeled", "open", "incident", time.Time{})); code != http.StatusAccepted {
+		t.Errorf("Wanted 202 without incident labels configured got %d", code)
+	}
+	if _, ok := store.Get("github/issue/acme/payments/12"); ok {
+		t.Error("Wanted no incident event")
+	}
+	if got := testenv.Value(t, exporter, "jira_incidents", nil); got != 0 {
+		t.Errorf("Wanted no incidents got %v", got)
+	}
+}
+
+func TestIssueDeploymentLinks(t *testing.T) {
+	issue := github.Issue{Labels: []github.Label{{Name: "incident"}, {Name: "deployment:v1.2.0"}, {Name: "deployment:2222222"}}}
+
+	links := issue.DeploymentLinks()
+	if len(links) != 2 || links[0] != "v1.2.0" || links[1] != "2222222" {
+		t.Errorf("Wanted v1.2.0 and 2222222 got %v", links)
+	}
+}
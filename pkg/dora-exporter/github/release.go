@@ -0,0 +1,309 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
+)
+
+const (
+	releaseEvent = "release"
+	tagEvent     = "tag"
+)
+
+var releaseRules []config.ReleaseRule
+
+type ReleasePayload struct {
+	Action     string
+	Release    Release
+	Repository Repository
+}
+
+// PushPayload is sent with push event, tags are pushed to refs/tags/<tag>
+type PushPayload struct {
+	Ref        string
+	Created    bool
+	Deleted    bool
+	Compare    string
+	Repository Repository
+}
+
+// Tag returns pushed tag, empty when branch was pushed
+func (payload PushPayload) Tag() string {
+	if !strings.HasPrefix(payload.Ref, "refs/tags/") {
+		return ""
+	}
+	return strings.TrimPrefix(payload.Ref, "refs/tags/")
+}
+
+// MatchReleaseRule returns the first rule matching release or tag event of repository
+func MatchReleaseRule(rules []config.ReleaseRule, event, repository, tag string, prerelease bool) (config.ReleaseRule, bool) {
+	for _, rule := range rules {
+		ruleEvent := rule.Event
+		if ruleEvent == "" {
+			ruleEvent = releaseEvent
+		}
+		if ruleEvent != event || !glob(rule.Repository, repository) || !glob(rule.Tag, tag) {
+			continue
+		}
+		if prerelease && !rule.Prereleases {
+			continue
+		}
+		return rule, true
+	}
+	return config.ReleaseRule{}, false
+}
+
+// PreviousRelease returns the latest release published before current matching the rule
+func PreviousRelease(releases []Release, current Release, rule config.ReleaseRule) (Release, bool) {
+	var previous Release
+	found := false
+	for _, release := range releases {
+		if release.Id == current.Id || release.Draft || (release.Prerelease && !rule.Prereleases) || !glob(rule.Tag, release.TagName) {
+			continue
+		}
+		if !release.PublishedAt.Before(current.PublishedAt) {
+			continue
+		}
+		if !found || release.PublishedAt.After(previous.PublishedAt) {
+			previous, found = release, true
+		}
+	}
+	return previous, found
+}
+
+// PreviousTag returns the highest version tag matching the rule which is lower than current,
+// GitHub tags API orders tags by name so v1.10.0 is listed before v1.9.0. Tags which aren't versions are skipped.
+func PreviousTag(tags []Tag, current string, rule config.ReleaseRule) (Tag, bool) {
+	currentVersion, ok := parseVersion(current)
+	if !ok {
+		return Tag{}, false
+	}
+
+	var previous Tag
+	var previousVersion version
+	found := false
+	for _, tag := range tags {
+		if !glob(rule.Tag, tag.Name) {
+			continue
+		}
+		v, ok := parseVersion(tag.Name)
+		if !ok || !v.less(currentVersion) {
+			continue
+		}
+		if !found || previousVersion.less(v) {
+			previous, previousVersion, found = tag, v, true
+		}
+	}
+	return previous, found
+}
+
+// version is semantic version of a tag like v1.2.3-rc.1, build metadata is ignored
+type version struct {
+	numbers    []int
+	prerelease []string
+}
+
+// parseVersion parses tag like v1.2, 1.2.3 or v1.2.3-rc.1+build
+func parseVersion(tag string) (version, bool) {
+	s := strings.TrimPrefix(tag, "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, prerelease, hasPrerelease := strings.Cut(s, "-")
+
+	var v version
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return version{}, false
+		}
+		v.numbers = append(v.numbers, n)
+	}
+	if hasPrerelease {
+		v.prerelease = strings.Split(prerelease, ".")
+	}
+	return v, true
+}
+
+// less compares versions by semantic versioning precedence, missing numbers are zeros
+func (v version) less(other version) bool {
+	for i := 0; i < len(v.numbers) || i < len(other.numbers); i++ {
+		a, b := versionNumber(v.numbers, i), versionNumber(other.numbers, i)
+		if a != b {
+			return a < b
+		}
+	}
+	// release follows its prereleases
+	if len(v.prerelease) == 0 || len(other.prerelease) == 0 {
+		return len(v.prerelease) > 0 && len(other.prerelease) == 0
+	}
+	for i := 0; i < len(v.prerelease) && i < len(other.prerelease); i++ {
+		a, b := v.prerelease[i], other.prerelease[i]
+		if a == b {
+			continue
+		}
+		an, aErr := strconv.Atoi(a)
+		bn, bErr := strconv.Atoi(b)
+		switch {
+		case aErr == nil && bErr == nil:
+			return an < bn
+		case aErr == nil || bErr == nil:
+			// numeric identifiers precede alphanumeric ones
+			return aErr == nil
+		default:
+			return a < b
+		}
+	}
+	return len(v.prerelease) < len(other.prerelease)
+}
+
+func versionNumber(numbers []int, i int) int {
+	if i < len(numbers) {
+		return numbers[i]
+	}
+	return 0
+}
+
+// newReleaseDeployment resolves team and lead time over commits between previous and released tag
+func newReleaseDeployment(repository Repository, rule config.ReleaseRule, previous, tag, sha string, at time.Time) tracker.Deployment {
+	d := tracker.Deployment{
+		Source:      "github",
+		Time:        at,
+		Repo:        repository.Name,
+		Environment: rule.Environment,
+		Status:      "success",
+		Sha:         sha,
+		Version:     tag,
+		Ref:         tag,
+		Provider:    "github",
+		Repository:  repository.Full_Name,
+	}
+	d.Team, d.Catalog = catalog.ResolveRepository(cat, repository.Full_Name)
+	if d.Team == catalog.UnknownTeam {
+		d.Errors = append(d.Errors, "catalog: no team for repository "+repository.Full_Name)
+	}
+
+	firstCommitDate, commits, err := githubApi.FindReleaseFirstCommit(repository.Name, previous, tag, sha)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "github", "repository", repository.Name, "tag", tag, "previous", previous, "error", err)
+		d.Errors = append(d.Errors, "lead time: "+err.Error())
+	} else {
+		d.LeadTime = d.Time.Sub(firstCommitDate).Seconds()
+		d.HasLeadTime = true
+	}
+	level.Debug(logger).Log("endpoint", "github", "repository", repository.Name, "tag", tag, "previous", previous, "commits", commits)
+	return d
+}
+
+// releaseHandler records published releases matching rules as deployments
+func releaseHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ReleasePayload
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "github", "event", "release", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	release := payload.Release
+	if payload.Action != "published" || release.Draft {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	rule, ok := MatchReleaseRule(releaseRules, releaseEvent, payload.Repository.Full_Name, release.TagName, release.Prerelease)
+	if !ok {
+		level.Debug(logger).Log("endpoint", "github", "event", "release", "tag", release.TagName, "repository", payload.Repository.Full_Name, "rule", "not_found")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if release.PublishedAt.IsZero() {
+		release.PublishedAt = time.Now()
+	}
+
+	repo := payload.Repository.Name
+	sha, err := githubApi.RefSha(repo, release.TagName)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "github", "repository", repo, "tag", release.TagName, "error", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	var previous string
+	releases, err := githubApi.Releases(repo)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "github", "repository", repo, "releases", "error", err)
+	} else if previousRelease, ok := PreviousRelease(releases, release, rule); ok {
+		previous = previousRelease.TagName
+	}
+
+	d := newReleaseDeployment(payload.Repository, rule, previous, release.TagName, sha, release.PublishedAt)
+	d.Id = fmt.Sprintf("github/release/%d", release.Id)
+	d.Exemplar = prom.NewExemplar(
+		"release_url", release.HtmlUrl,
+		"sha", sha,
+		"release_id", strconv.Itoa(release.Id),
+		"tag", release.TagName,
+	)
+
+	tracker.RecordDeployment(d)
+}
+
+// tagPushHandler records pushed tags matching rules as deployments
+func tagPushHandler(w http.ResponseWriter, r *http.Request) {
+	var payload PushPayload
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "github", "event", "push", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tag := payload.Tag()
+	if tag == "" || payload.Deleted {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	rule, ok := MatchReleaseRule(releaseRules, tagEvent, payload.Repository.Full_Name, tag, false)
+	if !ok {
+		level.Debug(logger).Log("endpoint", "github", "event", "push", "tag", tag, "repository", payload.Repository.Full_Name, "rule", "not_found")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	repo := payload.Repository.Name
+	// after is the tag object of annotated tags, not the tagged commit
+	sha, err := githubApi.RefSha(repo, tag)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "github", "repository", repo, "tag", tag, "error", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	var previous string
+	tags, err := githubApi.Tags(repo)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "github", "repository", repo, "tags", "error", err)
+	} else if previousTag, ok := PreviousTag(tags, tag, rule); ok {
+		previous = previousTag.Name
+	}
+
+	d := newReleaseDeployment(payload.Repository, rule, previous, tag, sha, time.Now())
+	d.Id = fmt.Sprintf("github/tag/%s/%s", payload.Repository.Full_Name, tag)
+	d.Exemplar = prom.NewExemplar(
+		"compare_url", payload.Compare,
+		"sha", sha,
+		"tag", tag,
+	)
+
+	tracker.RecordDeployment(d)
+}
@@ -0,0 +1,201 @@
+package github_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/github"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/internal/testenv"
+)
+
+var releaseRules = []config.ReleaseRule{
+	{Repository: "acme/mobile", Tag: "v*", Environment: "app-store"},
+	{Repository: "acme/sdk", Tag: "v*", Event: "tag", Environment: "registry"},
+	{Repository: "acme/beta", Prereleases: true, Environment: "testflight"},
+}
+
+func TestMatchReleaseRule(t *testing.T) {
+	examples := []struct {
+		event, repository, tag string
+		prerelease             bool
+		environment            string
+		ok                     bool
+	}{
+		{"release", "acme/mobile", "v1.2.0", false, "app-store", true},
+		{"release", "acme/mobile", "v1.3.0-rc1", true, "", false},
+		{"release", "acme/mobile", "nightly", false, "", false},
+		{"tag", "acme/mobile", "v1.2.0", false, "", false},
+		{"tag", "acme/sdk", "v0.4.1", false, "registry", true},
+		{"release", "acme/sdk", "v0.4.1", false, "", false},
+		{"release", "acme/beta", "1.0-beta", true, "testflight", true},
+	}
+
+	for _, example := range examples {
+		rule, ok := github.MatchReleaseRule(releaseRules, example.event, example.repository, example.tag, example.prerelease)
+		if ok != example.ok || rule.Environment != example.environment {
+			t.Errorf("%s %s %s: wanted %v %s got %v %s", example.event, example.repository, example.tag, example.ok, example.environment, ok, rule.Environment)
+		}
+	}
+}
+
+func TestPreviousRelease(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2021, 4, d, 0, 0, 0, 0, time.UTC) }
+	releases := []github.Release{
+		{Id: 5, TagName: "v1.3.0", PublishedAt: day(20)},
+		{Id: 4, TagName: "v1.2.0", PublishedAt: day(10)},
+		{Id: 3, TagName: "v1.2.0-rc1", Prerelease: true, PublishedAt: day(8)},
+		{Id: 2, TagName: "nightly", PublishedAt: day(7)},
+		{Id: 1, TagName: "v1.1.0", PublishedAt: day(1)},
+	}
+
+	previous, ok := github.PreviousRelease(releases, releases[0], releaseRules[0])
+	if !ok || previous.TagName != "v1.2.0" {
+		t.Errorf("Wanted v1.2.0 got %v %s", ok, previous.TagName)
+	}
+	// prereleases and tags not matching the rule are skipped
+	previous, ok = github.PreviousRelease(releases, releases[1], releaseRules[0])
+	if !ok || previous.TagName != "v1.1.0" {
+		t.Errorf("Wanted v1.1.0 got %v %s", ok, previous.TagName)
+	}
+	if _, ok = github.PreviousRelease(releases, releases[4], releaseRules[0]); ok {
+		t.Error("Wanted no previous release of the first one")
+	}
+}
+
+func TestPreviousTag(t *testing.T) {
+	// ordered by name like GitHub tags API does
+	tags := []github.Tag{{Name: "v0.9.0"}, {Name: "v0.5.0"}, {Name: "v0.4.1"}, {Name: "v0.10.0-rc.1"}, {Name: "v0.10.0"}, {Name: "v0.4.0"}, {Name: "latest"}}
+
+	examples := map[string]string{
+		"v0.4.1":  "v0.4.0",
+		"v0.5.0":  "v0.4.1",
+		"v0.6.0":  "v0.5.0",
+		"v0.4.0":  "",
+		"v0.10.0": "v0.10.0-rc.1",
+		"v0.11.0": "v0.10.0",
+		"v0.10.1": "v0.10.0",
+		"latest":  "",
+	}
+	for current, want := range examples {
+		previous, ok := github.PreviousTag(tags, current, releaseRules[1])
+		if ok != (want != "") || previous.Name != want {
+			t.Errorf("%s: wanted %s got %s", current, want, previous.Name)
+		}
+	}
+}
+
+func TestFindReleaseFirstCommit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/mobile/compare/v1.1.0...v1.2.0" {
+			t.Errorf("Unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"total_commits": 3, "commits": [
+			{"sha": "a", "commit": {"author": {"date": "2021-04-02T10:00:00Z"}}},
+			{"sha": "b", "commit": {"author": {"date": "2021-04-01T10:00:00Z"}}},
+			{"sha": "c", "commit": {"author": {"date": "2021-04-03T10:00:00Z"}}}
+		]}`))
+	}))
+	defer server.Close()
+
+	github.SetLogger(log.NewNopLogger())
+	u, _ := url.Parse(server.URL)
+	api := github.GithubApi{Owner: "acme", Token: "secret", BaseUrl: *u}
+
+	date, commits, err := api.FindReleaseFirstCommit("mobile", "v1.1.0", "v1.2.0", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commits != 3 || !date.Equal(time.Date(2021, 4, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Wanted the oldest of 3 commits got %v %d", date, commits)
+	}
+}
+
+func TestReleaseSkipped(t *testing.T) {
+	testenv.Setup(t, github.SetLogger)
+	github.SetGitHubApi(config.Github{Owner: "acme", Releases: releaseRules})
+
+	examples := []struct {
+		Event string
+		Body  string
+	}{
+		{"release", `{"action": "created", "release": {"tag_name": "v1.2.0"}, "repository": {"full_name": "acme/mobile"}}`},
+		{"release", `{"action": "published", "release": {"tag_name": "v1.3.0-rc1", "prerelease": true}, "repository": {"full_name": "acme/mobile"}}`},
+		{"push", `{"ref": "refs/heads/main", "repository": {"full_name": "acme/sdk"}}`},
+		{"push", `{"ref": "refs/tags/v0.4.1", "deleted": true, "repository": {"full_name": "acme/sdk"}}`},
+		{"push", `{"ref": "refs/tags/v0.4.1", "repository": {"full_name": "acme/mobile"}}`},
+	}
+	for _, example := range examples {
+		if code := testenv.Post(github.GithubAPIHandler, "/api/github", example.Body, "X-GitHub-Event", example.Event).Code; code != http.StatusAccepted {
+			t.Errorf("Wanted 202 got %d for %s", code, example.Body)
+		}
+	}
+}
+
+func TestTagsPaginated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/sdk/tags" || r.URL.Query().Get("per_page") != "100" {
+			t.Errorf("Unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		tags := []github.Tag{{Name: "v0.1.0"}}
+		if r.URL.Query().Get("page") == "1" {
+			tags = make([]github.Tag, 100)
+			for i := range tags {
+				tags[i].Name = fmt.Sprintf("v1.%d.0", i)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(tags)
+	}))
+	defer server.Close()
+
+	github.SetLogger(log.NewNopLogger())
+	u, _ := url.Parse(server.URL)
+	api := github.GithubApi{Owner: "acme", Token: "secret", BaseUrl: *u}
+
+	tags, err := api.Tags("sdk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 101 || tags[100].Name != "v0.1.0" {
+		t.Errorf("Wanted 101 tags of 2 pages got %d", len(tags))
+	}
+	previous, ok := github.PreviousTag(tags, "v1.0.0", releaseRules[1])
+	if !ok || previous.Name != "v0.1.0" {
+		t.Errorf("Wanted v0.1.0 from the second page got %v %s", ok, previous.Name)
+	}
+}
+
+func TestRefShaAnnotatedTag(t *testing.T) {
+	// commits API peels annotated tag to the tagged commit
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/sdk/commits/v0.4.1" {
+			t.Errorf("Unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"sha": "c0ffee"}`))
+	}))
+	defer server.Close()
+
+	github.SetLogger(log.NewNopLogger())
+	u, _ := url.Parse(server.URL)
+	api := github.GithubApi{Owner: "acme", Token: "secret", BaseUrl: *u}
+
+	sha, err := api.RefSha("sdk", "v0.4.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha != "c0ffee" {
+		t.Errorf("Wanted c0ffee got %s", sha)
+	}
+}
@@ -0,0 +1,133 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
+)
+
+var defaultConclusions = []string{"success", "failure"}
+
+var workflowRules []config.WorkflowRule
+
+type WorkflowRun struct {
+	Id         int
+	Name       string
+	HeadBranch string `json:"head_branch"`
+	HeadSha    string `json:"head_sha"`
+	// queued, in_progress or completed
+	Status string
+	// success, failure, cancelled, skipped, timed_out...
+	Conclusion string
+	HtmlUrl    string    `json:"html_url"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type WorkflowRunPayload struct {
+	Action      string
+	WorkflowRun WorkflowRun `json:"workflow_run"`
+	Repository  Repository
+}
+
+// glob reports whether value matches pattern, empty pattern matches everything
+func glob(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
+
+// MatchWorkflowRule returns the first rule matching completed workflow run
+func MatchWorkflowRule(rules []config.WorkflowRule, payload WorkflowRunPayload) (config.WorkflowRule, bool) {
+	run := payload.WorkflowRun
+	for _, rule := range rules {
+		if !glob(rule.Workflow, run.Name) || !glob(rule.Repository, payload.Repository.Full_Name) || !glob(rule.Branch, run.HeadBranch) {
+			continue
+		}
+
+		conclusions := rule.Conclusions
+		if len(conclusions) == 0 {
+			conclusions = defaultConclusions
+		}
+		for _, conclusion := range conclusions {
+			if conclusion == run.Conclusion {
+				return rule, true
+			}
+		}
+	}
+	return config.WorkflowRule{}, false
+}
+
+// workflowRunHandler records completed workflow runs matching rules as deployments
+func workflowRunHandler(w http.ResponseWriter, r *http.Request) {
+	var payload WorkflowRunPayload
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "github", "event", "workflow_run", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if payload.Action != "completed" {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	rule, ok := MatchWorkflowRule(workflowRules, payload)
+	if !ok {
+		level.Debug(logger).Log("endpoint", "github", "event", "workflow_run", "workflow", payload.WorkflowRun.Name, "repository", payload.Repository.Full_Name, "rule", "not_found")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	run := payload.WorkflowRun
+	d := tracker.Deployment{
+		Id:          fmt.Sprintf("github/workflow_run/%d", run.Id),
+		Source:      "github",
+		Time:        run.UpdatedAt,
+		Repo:        payload.Repository.Name,
+		Environment: rule.Environment,
+		Status:      run.Conclusion,
+		Sha:         run.HeadSha,
+		Failed:      run.Conclusion == "failure",
+		Ref:         run.HeadBranch,
+		Provider:    "github",
+		Repository:  payload.Repository.Full_Name,
+	}
+	if d.Time.IsZero() {
+		d.Time = time.Now()
+	}
+	d.Team, d.Catalog = catalog.ResolveRepository(cat, payload.Repository.Full_Name)
+	if d.Team == catalog.UnknownTeam {
+		d.Errors = append(d.Errors, "catalog: no team for repository "+payload.Repository.Full_Name)
+	}
+
+	firstCommitDate, pullRequest, err := githubApi.FindFirstCommit(payload.Repository.Name, run.HeadSha)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "github", "repository", payload.Repository.Name, "sha", run.HeadSha, "error", err)
+		d.Errors = append(d.Errors, "lead time: "+err.Error())
+	} else {
+		d.LeadTime = d.Time.Sub(firstCommitDate).Seconds()
+		d.HasLeadTime = true
+	}
+
+	d.ChangeLabels = pullRequestLabels(payload.Repository.Name, pullRequest)
+	d.Exemplar = prom.NewExemplar(
+		"workflow_run_url", run.HtmlUrl,
+		"sha", run.HeadSha,
+		"workflow_run_id", strconv.Itoa(run.Id),
+		"pull_request", pullRequest,
+	)
+
+	tracker.RecordDeployment(d)
+}
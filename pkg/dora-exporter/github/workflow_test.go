@@ -0,0 +1,74 @@
+package github_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/github"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/internal/testenv"
+)
+
+var rules = []config.WorkflowRule{
+	{Workflow: "Deploy *", Branch: "main", Environment: "production"},
+	{Workflow: "Deploy *", Branch: "release/*", Conclusions: []string{"success"}, Environment: "staging"},
+	{Workflow: "CD", Repository: "acme/legacy", Environment: "production"},
+}
+
+func workflowRun(name, repo, branch, conclusion string) github.WorkflowRunPayload {
+	var payload github.WorkflowRunPayload
+	payload.Action = "completed"
+	payload.WorkflowRun.Name = name
+	payload.WorkflowRun.HeadBranch = branch
+	payload.WorkflowRun.Conclusion = conclusion
+	payload.Repository.Full_Name = repo
+	return payload
+}
+
+func TestMatchWorkflowRule(t *testing.T) {
+	examples := []struct {
+		payload     github.WorkflowRunPayload
+		environment string
+		ok          bool
+	}{
+		{workflowRun("Deploy API", "acme/api", "main", "success"), "production", true},
+		{workflowRun("Deploy API", "acme/api", "main", "failure"), "production", true},
+		{workflowRun("Deploy API", "acme/api", "main", "cancelled"), "", false},
+		{workflowRun("Deploy API", "acme/api", "release/1.2", "success"), "staging", true},
+		{workflowRun("Deploy API", "acme/api", "release/1.2", "failure"), "", false},
+		{workflowRun("Deploy API", "acme/api", "feature/x", "success"), "", false},
+		{workflowRun("CD", "acme/legacy", "develop", "success"), "production", true},
+		{workflowRun("CD", "acme/api", "main", "success"), "", false},
+		{workflowRun("Tests", "acme/api", "main", "success"), "", false},
+	}
+
+	for _, example := range examples {
+		rule, ok := github.MatchWorkflowRule(rules, example.payload)
+		if ok != example.ok || rule.Environment != example.environment {
+			t.Errorf("%s %s %s: wanted %v %s got %v %s", example.payload.WorkflowRun.Name, example.payload.WorkflowRun.HeadBranch,
+				example.payload.WorkflowRun.Conclusion, example.ok, example.environment, ok, rule.Environment)
+		}
+	}
+}
+
+func TestWorkflowRunSkipped(t *testing.T) {
+	testenv.Setup(t, github.SetLogger)
+	github.SetGitHubApi(config.Github{Owner: "acme", Workflows: rules})
+
+	requested := workflowRun("Deploy API", "acme/api", "main", "")
+	requested.Action = "requested"
+	examples := []struct {
+		Name    string
+		Payload github.WorkflowRunPayload
+	}{
+		{Name: "requested", Payload: requested},
+		{Name: "without rule", Payload: workflowRun("Tests", "acme/api", "main", "success")},
+	}
+	for _, example := range examples {
+		body, _ := json.Marshal(example.Payload)
+		if code := testenv.Post(github.GithubAPIHandler, "/api/github", string(body), "X-GitHub-Event", "workflow_run").Code; code != http.StatusAccepted {
+			t.Errorf("%s: wanted 202 got %d", example.Name, code)
+		}
+	}
+}
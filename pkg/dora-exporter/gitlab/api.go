@@ -0,0 +1,235 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+)
+
+var logger log.Logger
+
+func SetLogger(log log.Logger) {
+	logger = log
+	return
+}
+
+// Page size and maximal amount of pages fetched from paginated endpoints
+const (
+	perPage  = 100
+	maxPages = 10
+)
+
+type GitlabApi struct {
+	Token string
+
+	BaseUrl url.URL
+}
+
+var gitlabApi GitlabApi
+
+var webhookToken string
+
+func SetGitlabApi(conf config.Gitlab) {
+	u, err := url.Parse(conf.BaseUrl)
+	if err != nil {
+		level.Error(logger).Log("component", "gitlab_api", "base_url", conf.BaseUrl, "error", err)
+		u = &url.URL{}
+	}
+	gitlabApi = GitlabApi{BaseUrl: *u, Token: conf.Token}
+	webhookToken = conf.WebhookToken
+}
+
+func GetGitlabApi() GitlabApi {
+	return gitlabApi
+}
+
+func (api GitlabApi) Fetch(path string) ([]byte, error) {
+	return api.FetchQuery(path, nil)
+}
+
+// FetchQuery is Fetch with query parameters
+func (api GitlabApi) FetchQuery(path string, query url.Values) ([]byte, error) {
+	uri := api.BaseUrl
+	uri.RawQuery = query.Encode()
+	// path keeps escaped project paths like group%2Fproject
+	uri.RawPath = strings.TrimSuffix(uri.EscapedPath(), "/") + "/api/v4" + path
+	unescaped, err := url.PathUnescape(uri.RawPath)
+	if err != nil {
+		return nil, err
+	}
+	uri.Path = unescaped
+
+	req, err := http.NewRequest(http.MethodGet, uri.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if api.Token != "" {
+		req.Header.Add("PRIVATE-TOKEN", api.Token)
+	}
+
+	client := http.Client{Timeout: 15 * time.Second}
+
+	level.Debug(logger).Log("component", "gitlab_api", "call", uri.String())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("gitlab: %s returned %s", uri.Path, resp.Status)
+	}
+
+	return body, nil
+}
+
+// FetchAll requests pages of path until a page isn't full, at most maxPages are fetched.
+// page decodes the response and returns the amount of items in it.
+func (api GitlabApi) FetchAll(path string, page func([]byte) (int, error)) error {
+	for i := 1; i <= maxPages; i++ {
+		resBody, err := api.FetchQuery(path, url.Values{"per_page": {strconv.Itoa(perPage)}, "page": {strconv.Itoa(i)}})
+		if err != nil {
+			return err
+		}
+		items, err := page(resBody)
+		if err != nil {
+			return err
+		}
+		if items < perPage {
+			return nil
+		}
+	}
+	return nil
+}
+
+type Commit struct {
+	Id           string
+	Title        string
+	AuthoredDate time.Time `json:"authored_date"`
+}
+
+type MergeRequest struct {
+	Iid    int
+	State  string
+	WebUrl string `json:"web_url"`
+}
+
+// https://gitlab.com/api/v4/projects/{{id}}/repository/commits/{{sha}}
+func (api GitlabApi) CommitInfo(project string, sha string) (Commit, error) {
+	var commit Commit
+	resBody, err := api.Fetch(fmt.Sprintf("/projects/%s/repository/commits/%s", url.PathEscape(project), sha))
+	if err != nil {
+		return commit, err
+	}
+
+	err = json.Unmarshal(resBody, &commit)
+	return commit, err
+}
+
+// https://gitlab.com/api/v4/projects/{{id}}/repository/commits/{{sha}}/merge_requests
+func (api GitlabApi) CommitMergeRequests(project string, sha string) ([]MergeRequest, error) {
+	var mergeRequests []MergeRequest
+	resBody, err := api.Fetch(fmt.Sprintf("/projects/%s/repository/commits/%s/merge_requests", url.PathEscape(project), sha))
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(resBody, &mergeRequests)
+	return mergeRequests, err
+}
+
+// https://gitlab.com/api/v4/projects/{{id}}/merge_requests/{{iid}}/commits
+func (api GitlabApi) MergeRequestCommits(project string, iid int) ([]Commit, error) {
+	var commits []Commit
+	err := api.FetchAll(fmt.Sprintf("/projects/%s/merge_requests/%d/commits", url.PathEscape(project), iid), func(resBody []byte) (int, error) {
+		var page []Commit
+		if err := json.Unmarshal(resBody, &page); err != nil {
+			return 0, err
+		}
+		commits = append(commits, page...)
+		return len(page), nil
+	})
+	return commits, err
+}
+
+// https://gitlab.com/api/v4/projects/{{id}}/repository/merge_base?refs[]={{sha}}&refs[]={{sha}}
+func (api GitlabApi) MergeBase(project string, refs ...string) (Commit, error) {
+	var commit Commit
+	resBody, err := api.FetchQuery(fmt.Sprintf("/projects/%s/repository/merge_base", url.PathEscape(project)), url.Values{"refs[]": refs})
+	if err != nil {
+		return commit, err
+	}
+
+	err = json.Unmarshal(resBody, &commit)
+	return commit, err
+}
+
+// IsAncestor reports whether ancestor commit is reachable from sha, i.e. it is their merge base
+func (api GitlabApi) IsAncestor(project, ancestor, sha string) (bool, error) {
+	base, err := api.MergeBase(project, ancestor, sha)
+	if err != nil {
+		return false, fmt.Errorf("merge base of %s and %s: %w", ancestor, sha, err)
+	}
+	return base.Id != "" && strings.HasPrefix(base.Id, ancestor), nil
+}
+
+// FindFirstCommit returns the date of the first commit of the merge request which brought sha,
+// or the date of the commit itself when it has no merge request. Merge request iid is empty without one.
+// Project is either numeric id or path with namespace like group/project.
+func (api GitlabApi) FindFirstCommit(project, sha string) (time.Time, string, error) {
+	mergeRequests, err := api.CommitMergeRequests(project, sha)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("merge requests of %s: %w", sha, err)
+	}
+
+	if len(mergeRequests) == 0 {
+		commit, err := api.CommitInfo(project, sha)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("commit %s: %w", sha, err)
+		}
+		level.Debug(logger).Log("project", project, "sha", sha, "date", "current_commit")
+		return commit.AuthoredDate, "", nil
+	}
+
+	// prefer merged request, the commit can be part of several
+	mergeRequest := mergeRequests[0]
+	for _, mr := range mergeRequests {
+		if mr.State == "merged" {
+			mergeRequest = mr
+			break
+		}
+	}
+	iid := strconv.Itoa(mergeRequest.Iid)
+
+	commits, err := api.MergeRequestCommits(project, mergeRequest.Iid)
+	if err != nil {
+		return time.Time{}, iid, fmt.Errorf("merge request %s: %w", iid, err)
+	}
+	if len(commits) == 0 {
+		return time.Time{}, iid, fmt.Errorf("merge request %s: no commits", iid)
+	}
+
+	first := commits[0].AuthoredDate
+	for _, commit := range commits {
+		if commit.AuthoredDate.Before(first) {
+			first = commit.AuthoredDate
+		}
+	}
+	level.Debug(logger).Log("project", project, "sha", sha, "MR", iid, "date", "mr_first_commit")
+	return first, iid, nil
+}
@@ -0,0 +1,241 @@
+package gitlab
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
+)
+
+// Webhook timestamps differ between GitLab versions and event types
+var gitlabTimeFormats = []string{time.RFC3339, "2006-01-02 15:04:05 -0700", "2006-01-02 15:04:05 MST"}
+
+type GitlabTime struct {
+	time.Time
+}
+
+func (gtime *GitlabTime) UnmarshalJSON(b []byte) (err error) {
+	s := strings.Trim(string(b), "\"")
+	if s == "null" || s == "" {
+		gtime.Time = time.Time{}
+		return nil
+	}
+	for _, format := range gitlabTimeFormats {
+		if gtime.Time, err = time.Parse(format, s); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+type Project struct {
+	Id                int
+	Name              string
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebUrl            string `json:"web_url"`
+}
+
+// Repo returns project path used as repo label
+func (project Project) Repo() string {
+	return path.Base(project.PathWithNamespace)
+}
+
+// DeploymentPayload is sent with Deployment Hook event
+type DeploymentPayload struct {
+	ObjectKind      string     `json:"object_kind"`
+	Status          string     `json:"status"`
+	StatusChangedAt GitlabTime `json:"status_changed_at"`
+	DeploymentId    int        `json:"deployment_id"`
+	DeployableUrl   string     `json:"deployable_url"`
+	Environment     string     `json:"environment"`
+	Project         Project    `json:"project"`
+	ShortSha        string     `json:"short_sha"`
+	CommitUrl       string     `json:"commit_url"`
+	Ref             string     `json:"ref"`
+}
+
+// Sha returns full commit sha from commit url, deployment events carry only the short one
+func (payload DeploymentPayload) Sha() string {
+	if i := strings.LastIndex(payload.CommitUrl, "/"); i >= 0 && len(payload.CommitUrl)-i-1 > len(payload.ShortSha) {
+		return payload.CommitUrl[i+1:]
+	}
+	return payload.ShortSha
+}
+
+type Build struct {
+	Id          int
+	Name        string
+	Stage       string
+	Status      string
+	Environment *struct {
+		Name   string
+		Action string
+	}
+}
+
+// PipelinePayload is sent with Pipeline Hook event
+type PipelinePayload struct {
+	ObjectKind       string `json:"object_kind"`
+	ObjectAttributes struct {
+		Id         int
+		Ref        string
+		Sha        string
+		Status     string
+		CreatedAt  GitlabTime `json:"created_at"`
+		FinishedAt GitlabTime `json:"finished_at"`
+		Url        string
+	} `json:"object_attributes"`
+	Project Project `json:"project"`
+	Builds  []Build `json:"builds"`
+}
+
+// Environment returns environment deployed by the pipeline, empty when pipeline has no deployment job
+func (payload PipelinePayload) Environment() string {
+	for _, build := range payload.Builds {
+		if build.Environment != nil && build.Environment.Name != "" && (build.Environment.Action == "" || build.Environment.Action == "start") {
+			return build.Environment.Name
+		}
+	}
+	return ""
+}
+
+// Pipeline statuses which are final, pipelines in progress are not reported as deployments
+var finishedPipelineStatuses = map[string]bool{"success": true, "failed": true, "canceled": true}
+
+var cat catalog.TeamsCatalog
+
+func SetCatalog(catalog catalog.TeamsCatalog) {
+	cat = catalog
+	level.Info(logger).Log("gitlab", "catalog service set")
+}
+
+// failed reports whether deployment or pipeline status is a failure
+func failed(status string) bool {
+	return status == "failed"
+}
+
+// leadTime returns seconds between the first commit and deployment time
+func leadTime(project int, sha string, at time.Time) (float64, string, error) {
+	firstCommitDate, mergeRequest, err := gitlabApi.FindFirstCommit(strconv.Itoa(project), sha)
+	if err != nil {
+		return 0, mergeRequest, err
+	}
+	return at.Sub(firstCommitDate).Seconds(), mergeRequest, nil
+}
+
+func eventTime(t GitlabTime) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t.Time
+}
+
+func GitlabAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if webhookToken != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(webhookToken)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var deployment tracker.Deployment
+	var err error
+
+	switch r.Header.Get("X-Gitlab-Event") {
+	case "Deployment Hook":
+		var payload DeploymentPayload
+		if err = json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			break
+		}
+		deployment = deploymentFromDeploymentHook(payload)
+	case "Pipeline Hook":
+		var payload PipelinePayload
+		if err = json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			break
+		}
+		if payload.Environment() == "" || !finishedPipelineStatuses[payload.ObjectAttributes.Status] {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		deployment = deploymentFromPipelineHook(payload)
+	default:
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if err != nil {
+		level.Error(logger).Log("endpoint", "gitlab", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tracker.RecordDeployment(deployment)
+}
+
+// newDeployment resolves team and lead time of sha deployed to project
+func newDeployment(project Project, sha string, at time.Time) (tracker.Deployment, string) {
+	d := tracker.Deployment{
+		Source:     "gitlab",
+		Time:       at,
+		Repo:       project.Repo(),
+		Sha:        sha,
+		Provider:   "gitlab",
+		Repository: strconv.Itoa(project.Id),
+	}
+	d.Team, d.Catalog = catalog.ResolveRepository(cat, project.PathWithNamespace)
+	if d.Team == catalog.UnknownTeam {
+		d.Errors = append(d.Errors, "catalog: no team for repository "+project.PathWithNamespace)
+	}
+
+	duration, mergeRequest, err := leadTime(project.Id, sha, at)
+	if err != nil {
+		level.Error(logger).Log("endpoint", "gitlab", "repository", project.PathWithNamespace, "sha", sha, "error", err)
+		d.Errors = append(d.Errors, "lead time: "+err.Error())
+	} else {
+		d.LeadTime = duration
+		d.HasLeadTime = true
+	}
+	return d, mergeRequest
+}
+
+func deploymentFromDeploymentHook(payload DeploymentPayload) tracker.Deployment {
+	d, mergeRequest := newDeployment(payload.Project, payload.Sha(), eventTime(payload.StatusChangedAt))
+
+	d.Id = fmt.Sprintf("gitlab/%d/deployment/%d", payload.Project.Id, payload.DeploymentId)
+	d.Environment = payload.Environment
+	d.Ref = payload.Ref
+	d.Status = payload.Status
+	d.Failed = failed(payload.Status)
+	d.Exemplar = prom.NewExemplar(
+		"deployment_url", payload.DeployableUrl,
+		"sha", d.Sha,
+		"deployment_id", strconv.Itoa(payload.DeploymentId),
+		"merge_request", mergeRequest,
+	)
+	return d
+}
+
+func deploymentFromPipelineHook(payload PipelinePayload) tracker.Deployment {
+	attributes := payload.ObjectAttributes
+	d, mergeRequest := newDeployment(payload.Project, attributes.Sha, eventTime(attributes.FinishedAt))
+
+	d.Id = fmt.Sprintf("gitlab/%d/pipeline/%d", payload.Project.Id, attributes.Id)
+	d.Environment = payload.Environment()
+	d.Ref = attributes.Ref
+	d.Status = attributes.Status
+	d.Failed = failed(attributes.Status)
+	d.Exemplar = prom.NewExemplar(
+		"pipeline_url", attributes.Url,
+		"sha", d.Sha,
+		"pipeline_id", strconv.Itoa(attributes.Id),
+		"merge_request", mergeRequest,
+	)
+	return d
+}
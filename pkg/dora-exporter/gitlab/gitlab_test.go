@@ -0,0 +1,204 @@
+package gitlab_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/gitlab"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/internal/testenv"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const sha = "b83d6e391c22777fca1ed3012fce84f633d7fed0"
+
+// gitlabServer serves merge request of sha with two pages of commits, other commits have no merge requests
+func gitlabServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v4/projects/15/repository/commits/" + sha + "/merge_requests":
+			_ = json.NewEncoder(w).Encode([]map[string]interface{}{{"iid": 7, "state": "merged"}})
+		case "/api/v4/projects/15/merge_requests/7/commits":
+			if r.URL.Query().Get("per_page") != "100" {
+				t.Errorf("Unexpected page size %s", r.URL)
+			}
+			// the first commit is on the last page
+			commits := []map[string]string{{"id": "a", "authored_date": "2021-04-28T10:00:00Z"}}
+			if r.URL.Query().Get("page") == "1" {
+				commits = nil
+				for i := 0; i < 100; i++ {
+					commits = append(commits, map[string]string{"id": fmt.Sprint(i), "authored_date": "2021-04-28T12:00:00Z"})
+				}
+			}
+			_ = json.NewEncoder(w).Encode(commits)
+		case "/api/v4/projects/15/repository/commits/c0ffee/merge_requests":
+			_, _ = w.Write([]byte(`[]`))
+		case "/api/v4/projects/15/repository/commits/c0ffee":
+			_, _ = w.Write([]byte(`{"id": "c0ffee", "authored_date": "2021-04-28T19:00:00Z"}`))
+		default:
+			t.Errorf("Unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func setup(t *testing.T) (*events.Store, *prom.Exporter) {
+	store, exporter := testenv.Setup(t, gitlab.SetLogger)
+
+	server := gitlabServer(t)
+	t.Cleanup(server.Close)
+
+	gitlab.SetGitlabApi(config.Gitlab{BaseUrl: server.URL, Token: "secret", WebhookToken: "hook"})
+	gitlab.SetCatalog(catalog.NewCatalogFromYaml("- name: Payments\n  github_repositories: [acme/payments/*]\n"))
+	return store, exporter
+}
+
+func post(event, token, body string) int {
+	return testenv.Post(gitlab.GitlabAPIHandler, "/api/gitlab", body, "X-Gitlab-Event", event, "X-Gitlab-Token", token).Code
+}
+
+func TestDeploymentHook(t *testing.T) {
+	store, exporter := setup(t)
+
+	if code := post("Deployment Hook", "hook", testenv.Fixture(t, "deployment.json", nil)); code != http.StatusOK {
+		t.Fatalf("Wanted 200 got %d", code)
+	}
+
+	e, ok := store.Get("gitlab/15/deployment/15")
+	if !ok {
+		t.Fatal("Wanted deployment event")
+	}
+	if e.Team != "Payments" || e.Repo != "api" || e.Environment != "production" || e.Sha != sha || e.Failed {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	// first merge request commit at 10:00
+	if e.LeadTime != (11 * time.Hour).Seconds() {
+		t.Errorf("Wanted 11h lead time got %v", e.LeadTime)
+	}
+
+	labels := prometheus.Labels{"repo": "api", "environment": "production", "team": "Payments", "status": "success"}
+	if got := testenv.Value(t, exporter, "github_deployments_total", labels); got != 1 {
+		t.Errorf("Wanted 1 deployment got %v", got)
+	}
+	if got := testenv.Value(t, exporter, "github_deployments_duration_sum", labels); got != (11 * time.Hour).Seconds() {
+		t.Errorf("Wanted 11h lead time sum got %v", got)
+	}
+}
+
+func TestPipelineHook(t *testing.T) {
+	store, exporter := setup(t)
+
+	examples := []struct {
+		Name   string
+		Body   string
+		Status int
+	}{
+		{Name: "running", Body: testenv.Fixture(t, "pipeline.json", map[string]string{"Status": "running"}), Status: http.StatusAccepted},
+		{Name: "without deployment jobs", Body: `{"object_attributes": {"status": "success"}, "builds": []}`, Status: http.StatusAccepted},
+		{Name: "failed", Body: testenv.Fixture(t, "pipeline.json", map[string]string{"Status": "failed"}), Status: http.StatusOK},
+	}
+	for _, example := range examples {
+		if code := post("Pipeline Hook", "hook", example.Body); code != example.Status {
+			t.Fatalf("%s: wanted %d got %d", example.Name, example.Status, code)
+		}
+	}
+
+	e, ok := store.Get("gitlab/15/pipeline/31")
+	if !ok {
+		t.Fatal("Wanted pipeline event")
+	}
+	if !e.Failed || e.Environment != "production" || e.LeadTime != (2*time.Hour).Seconds() {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	// skipped pipelines aren't counted
+	if got := testenv.Value(t, exporter, "github_deployments_total", prometheus.Labels{"repo": "api", "team": "Payments"}); got != 1 {
+		t.Errorf("Wanted 1 deployment got %v", got)
+	}
+	if got := testenv.Value(t, exporter, "github_deployments_total", prometheus.Labels{"status": "failed"}); got != 1 {
+		t.Errorf("Wanted 1 failed deployment got %v", got)
+	}
+}
+
+func TestWebhookToken(t *testing.T) {
+	setup(t)
+
+	examples := []struct {
+		Event  string
+		Token  string
+		Status int
+	}{
+		{Event: "Deployment Hook", Token: "wrong", Status: http.StatusUnauthorized},
+		{Event: "Push Hook", Token: "hook", Status: http.StatusAccepted},
+	}
+	for _, example := range examples {
+		if code := post(example.Event, example.Token, `{}`); code != example.Status {
+			t.Errorf("%s: wanted %d got %d", example.Event, example.Status, code)
+		}
+	}
+}
+
+func TestFindFirstCommitByPath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/acme%2Fpayments%2Fapi/repository/commits/c0ffee/merge_requests":
+			_, _ = w.Write([]byte(`[]`))
+		case "/api/v4/projects/acme%2Fpayments%2Fapi/repository/commits/c0ffee":
+			_, _ = w.Write([]byte(`{"id": "c0ffee", "authored_date": "2021-04-28T19:00:00Z"}`))
+		default:
+			t.Errorf("Unexpected request %s", r.URL.EscapedPath())
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	gitlab.SetLogger(log.NewNopLogger())
+	gitlab.SetGitlabApi(config.Gitlab{BaseUrl: server.URL})
+
+	date, mergeRequest, err := gitlab.GetGitlabApi().FindFirstCommit("acme/payments/api", "c0ffee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !date.Equal(time.Date(2021, 4, 28, 19, 0, 0, 0, time.UTC)) || mergeRequest != "" {
+		t.Errorf("Unexpected first commit %v %q", date, mergeRequest)
+	}
+}
+
+func TestIsAncestor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/projects/42/repository/merge_base" {
+			t.Errorf("Unexpected request %s", r.URL.Path)
+		}
+		refs := r.URL.Query()["refs[]"]
+		if len(refs) != 2 {
+			t.Errorf("Unexpected refs %v", refs)
+		}
+		_, _ = w.Write([]byte(`{"id": "c0ffee0000"}`))
+	}))
+	defer server.Close()
+
+	gitlab.SetLogger(log.NewNopLogger())
+	gitlab.SetGitlabApi(config.Gitlab{BaseUrl: server.URL})
+
+	for ancestor, expected := range map[string]bool{"c0ffee0000": true, "beef": false} {
+		ok, err := gitlab.GetGitlabApi().IsAncestor("42", ancestor, "deadbeef")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != expected {
+			t.Errorf("IsAncestor of %s: expected %v", ancestor, expected)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Package testenv prepares the exporter state shared by tests of webhook handlers
+package testenv
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/go-kit/log"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Setup silences logs of the tracker, metrics, catalog, events and packages given by their SetLogger,
+// installs a new exporter and an event store in a temporary directory of the test
+func Setup(t testing.TB, loggers ...func(log.Logger)) (*events.Store, *prom.Exporter) {
+	t.Helper()
+
+	logger := log.NewNopLogger()
+	for _, setLogger := range append([]func(log.Logger){tracker.SetLogger, prom.SetLogger, catalog.SetLogger, events.SetLogger}, loggers...) {
+		setLogger(logger)
+	}
+
+	exporter := prom.NewExporter()
+	prom.SetExporter(exporter)
+
+	store := events.NewStore(filepath.Join(t.TempDir(), "events.json"), 0, 0)
+	events.SetStore(store)
+	return store, exporter
+}
+
+// Post sends body to handler, headers are given as name and value pairs
+func Post(handler http.HandlerFunc, path, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// Fixture returns testdata/name of the tested package, executed as a template with data unless it is nil
+func Fixture(t testing.TB, name string, data interface{}) string {
+	t.Helper()
+
+	content, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data == nil {
+		return string(content)
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body strings.Builder
+	if err = tmpl.Execute(&body, data); err != nil {
+		t.Fatal(err)
+	}
+	return body.String()
+}
+
+// Sign returns hex encoded HMAC-SHA256 of body, webhooks are signed so
+func Sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Value returns sum of the series of metric matching labels, histograms are counted by observations.
+// Labels missing in the series don't match, not listed labels match any value.
+func Value(t testing.TB, collector prometheus.Collector, name string, labels prometheus.Labels) float64 {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal(err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var value float64
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			values := map[string]string{}
+			for _, pair := range metric.GetLabel() {
+				values[pair.GetName()] = pair.GetValue()
+			}
+			if !matches(values, labels) {
+				continue
+			}
+			switch {
+			case metric.Counter != nil:
+				value += metric.GetCounter().GetValue()
+			case metric.Gauge != nil:
+				value += metric.GetGauge().GetValue()
+			case metric.Histogram != nil:
+				value += float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return value
+}
+
+func matches(values map[string]string, labels prometheus.Labels) bool {
+	for name, value := range labels {
+		if got, ok := values[name]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
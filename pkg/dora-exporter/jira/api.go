@@ -0,0 +1,141 @@
+package jira
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+)
+
+const defaultPageSize = 50
+
+// Fields requested from the search API, everything else is ignored
+const searchFields = "created,resolutiondate,status,project,issuetype,labels"
+
+type JiraApi struct {
+	Email, Token string
+
+	BaseUrl url.URL
+}
+
+var jiraApi JiraApi
+
+func SetJiraApi(conf config.Jira) {
+	u, err := url.Parse(conf.BaseUrl)
+	if err != nil {
+		level.Error(logger).Log("component", "jira_api", "base_url", conf.BaseUrl, "error", err)
+		u = &url.URL{}
+	}
+	jiraApi = JiraApi{BaseUrl: *u,
+		Email: conf.Email,
+		Token: conf.Token}
+	backfillState = conf.Backfill.State
+}
+
+func GetJiraApi() JiraApi {
+	return jiraApi
+}
+
+func (api JiraApi) Fetch(path string, query url.Values) ([]byte, error) {
+	uri := api.BaseUrl
+	uri.Path = path
+	uri.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, uri.String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/json")
+
+	// Jira Cloud uses basic auth with API token, Data Center accepts PAT as bearer
+	if api.Email != "" {
+		req.SetBasicAuth(api.Email, api.Token)
+	} else if api.Token != "" {
+		req.Header.Add("Authorization", "Bearer "+api.Token)
+	}
+
+	client := http.Client{Timeout: 15 * time.Second}
+
+	level.Debug(logger).Log("component", "jira_api", "call", uri.String())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("jira: %s returned %s", uri.Path, resp.Status)
+	}
+
+	return body, nil
+}
+
+type SearchResult struct {
+	StartAt    int
+	MaxResults int
+	Total      int
+	Issues     []Issue
+}
+
+// https://developer.atlassian.com/cloud/jira/platform/rest/v2/api-group-issue-search/#api-rest-api-2-search-get
+func (api JiraApi) Search(jql string, startAt, maxResults int) (SearchResult, error) {
+	var result SearchResult
+
+	query := url.Values{}
+	query.Set("jql", jql)
+	query.Set("startAt", strconv.Itoa(startAt))
+	query.Set("maxResults", strconv.Itoa(maxResults))
+	if deploymentField != "" {
+		query.Set("fields", searchFields+","+deploymentField)
+	} else {
+		query.Set("fields", searchFields)
+	}
+
+	resBody, err := api.Fetch("/rest/api/2/search", query)
+	if err != nil {
+		return result, err
+	}
+
+	err = json.Unmarshal(resBody, &result)
+	if err != nil {
+		return result, err
+	}
+
+	level.Debug(logger).Log("component", "jira_api", "jql", jql, "start_at", startAt, "issues", len(result.Issues), "total", result.Total)
+
+	return result, nil
+}
+
+// SearchAll pages through the search results until all issues matching jql are fetched
+func (api JiraApi) SearchAll(jql string, pageSize int) ([]Issue, error) {
+	var issues []Issue
+
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	for {
+		result, err := api.Search(jql, len(issues), pageSize)
+		if err != nil {
+			return issues, err
+		}
+
+		issues = append(issues, result.Issues...)
+
+		if len(result.Issues) == 0 || len(issues) >= result.Total {
+			return issues, nil
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package jira_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/jira"
+)
+
+func TestSearchAll(t *testing.T) {
+	jira.SetLogger(log.NewLogfmtLogger(os.Stderr))
+
+	var keys []string
+	for i := 1; i <= 5; i++ {
+		keys = append(keys, fmt.Sprintf("INF-%d", i))
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "bot@example.com" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("jql") != "project = INF" {
+			t.Errorf("Unexpected jql %s", r.URL.Query().Get("jql"))
+		}
+
+		startAt, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+		maxResults, _ := strconv.Atoi(r.URL.Query().Get("maxResults"))
+		end := startAt + maxResults
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		var issues []map[string]interface{}
+		for _, key := range keys[startAt:end] {
+			issues = append(issues, map[string]interface{}{
+				"key": key,
+				"fields": map[string]interface{}{
+					"created":        "2022-09-15T05:57:02.000+0000",
+					"resolutiondate": "2022-09-15T07:57:02.000+0000",
+					"project":        map[string]string{"key": "INF"},
+				},
+			})
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"startAt":    startAt,
+			"maxResults": maxResults,
+			"total":      len(keys),
+			"issues":     issues,
+		})
+	}))
+	defer server.Close()
+
+	jira.SetJiraApi(config.Jira{BaseUrl: server.URL, Email: "bot@example.com", Token: "secret"})
+
+	issues, err := jira.GetJiraApi().SearchAll("project = INF", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) != len(keys) {
+		t.Fatalf("Wanted %d issues got %d", len(keys), len(issues))
+	}
+
+	for i, issue := range issues {
+		if issue.Key != keys[i] {
+			t.Errorf("Wanted %s got %s", keys[i], issue.Key)
+		}
+		if issue.GetResolutionDuration() != 7200 {
+			t.Errorf("Wanted resolution duration 7200 got %v", issue.GetResolutionDuration())
+		}
+	}
+}
+
+func TestSearchUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	jira.SetJiraApi(config.Jira{BaseUrl: server.URL, Token: "wrong"})
+
+	_, err := jira.GetJiraApi().SearchAll("project = INF", 2)
+	if err == nil {
+		t.Error("Wanted error for unauthorized request")
+	}
+}
@@ -0,0 +1,142 @@
+package jira
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// backfillState is the file with imported issues, the event log drops issues older than
+// its retention so it can't tell historical issues were imported already
+var backfillState string
+
+// importedIssues maps key of imported issue to its resolution date, zero while unresolved
+type importedIssues map[string]time.Time
+
+// loadImported reads imported issues, missing file or empty path is an empty set
+func loadImported(path string) (importedIssues, error) {
+	imported := importedIssues{}
+	if path == "" {
+		return imported, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return imported, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &imported)
+	return imported, err
+}
+
+func (imported importedIssues) save(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(imported)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0o644)
+}
+
+// known returns resolution date of the issue imported before or received by webhook
+func (imported importedIssues) known(key string) (time.Time, bool) {
+	if resolved, ok := imported[key]; ok {
+		return resolved, true
+	}
+	e, ok := events.Get("jira/" + key)
+	if !ok {
+		return time.Time{}, false
+	}
+	if e.Resolved == nil {
+		return time.Time{}, true
+	}
+	return *e.Resolved, true
+}
+
+// Backfill imports incidents matching jql into the incident metrics.
+// Resolved issues contribute time between creation and resolution to the duration.
+// Issues imported before or received by webhook are skipped unless they were resolved since,
+// then only the restore time is added. Returns the amount of imported and resolved issues.
+func Backfill(jql string, pageSize int) (int, error) {
+	issues, err := jiraApi.SearchAll(jql, pageSize)
+	if err != nil {
+		level.Error(logger).Log("backfill", "jira", "jql", jql, "imported", len(issues), "error", err)
+		return 0, err
+	}
+	imported, err := loadImported(backfillState)
+	if err != nil {
+		level.Error(logger).Log("backfill", "jira", "state", backfillState, "error", err)
+		return 0, err
+	}
+
+	// remote write receivers expect samples of the series in chronological order
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Fields.Created.Before(issues[j].Fields.Created.Time)
+	})
+
+	var added, resolved int
+	for _, issue := range issues {
+		resolution, known := imported.known(issue.Key)
+		unresolved := issue.Fields.ResolutionDate.IsZero()
+		if known && (!resolution.IsZero() || unresolved) {
+			imported[issue.Key] = resolution
+			level.Debug(logger).Log("backfill", "jira", "key", issue.Key, "skipped", "known")
+			continue
+		}
+
+		team, provider := catalog.ResolveProject(cat, issue.Fields.Project.Key)
+		labels := prometheus.Labels{
+			"team":    team,
+			"project": issue.Fields.Project.Key,
+		}
+		parentTeam, department := catalog.GetParentTeams(cat, labels["team"])
+		prom.SetHierarchyLabels(labels, parentTeam, department)
+
+		if known {
+			resolved++
+		} else {
+			added++
+			prom.IncIncidentsCount(labels)
+			prom.PushIncident("jira/"+issue.Key, labels, issue.Fields.Created.Time)
+		}
+		event := issue.Event(labels)
+		event.Catalog = provider
+		events.Record(event)
+		imported[issue.Key] = issue.Fields.ResolutionDate.Time
+
+		if unresolved {
+			level.Debug(logger).Log("backfill", "jira", "key", issue.Key, "resolution", "unresolved")
+			continue
+		}
+		prom.AddIncidentsDuration(labels, issue.GetResolutionDuration())
+		prom.PushRestoreTime("jira/"+issue.Key, labels, issue.Fields.ResolutionDate.Time, issue.GetResolutionDuration())
+
+		level.Debug(logger).Log(
+			"backfill", "jira",
+			"key", issue.Key,
+			"team", labels["team"],
+			"created", issue.Fields.Created,
+			"resolved", issue.Fields.ResolutionDate,
+			"duration", issue.GetResolutionDuration())
+	}
+
+	if err = imported.save(backfillState); err != nil {
+		level.Error(logger).Log("backfill", "jira", "state", backfillState, "error", err)
+		return added + resolved, err
+	}
+
+	level.Info(logger).Log("backfill", "jira", "jql", jql, "found", len(issues), "imported", added, "resolved", resolved)
+	return added + resolved, nil
+}
@@ -0,0 +1,64 @@
+package jira_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/internal/testenv"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/jira"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBackfillSkipsKnownIssues(t *testing.T) {
+	var fixture string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, fixture)
+	}))
+	defer server.Close()
+
+	_, exporter := testenv.Setup(t, jira.SetLogger)
+	// historical issues are older than the retention of the event log
+	events.SetStore(events.NewStore(filepath.Join(t.TempDir(), "events.json"), 24*time.Hour, 0))
+	jira.SetCatalog(catalog.NewCatalogFromYaml("- name: Infra\n  jira_projects: [INF]\n"))
+	conf := config.Jira{BaseUrl: server.URL}
+	conf.Backfill.State = filepath.Join(t.TempDir(), "backfill.json")
+	jira.SetJiraApi(conf)
+
+	infra := prometheus.Labels{"project": "INF", "team": "Infra"}
+	examples := []struct {
+		Fixture   string
+		Imported  int
+		Incidents float64
+		Duration  float64
+	}{
+		{Fixture: "testdata/search_open.json", Imported: 2, Incidents: 2, Duration: 7200},
+		// repeated run doesn't count issues pruned from the event log again
+		{Fixture: "testdata/search_open.json", Imported: 0, Incidents: 2, Duration: 7200},
+		// issue resolved since adds its restore time only
+		{Fixture: "testdata/search_resolved.json", Imported: 1, Incidents: 2, Duration: 10800},
+		{Fixture: "testdata/search_resolved.json", Imported: 0, Incidents: 2, Duration: 10800},
+	}
+
+	for run, example := range examples {
+		fixture = example.Fixture
+		imported, err := jira.Backfill("project = INF", 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if imported != example.Imported {
+			t.Errorf("run %d: wanted %d imported issues got %d", run, example.Imported, imported)
+		}
+		if got := testenv.Value(t, exporter, "jira_incidents", infra); got != example.Incidents {
+			t.Errorf("run %d: wanted %v incidents got %v", run, example.Incidents, got)
+		}
+		if got := testenv.Value(t, exporter, "jira_incidents_duration_sum", infra); got != example.Duration {
+			t.Errorf("run %d: wanted %v restore time got %v", run, example.Duration, got)
+		}
+	}
+}
@@ -10,7 +10,9 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
 	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -34,6 +36,37 @@ func (issue Issue) GetDuration() float64 {
 	return time.Since(issue.Fields.Created.Time).Seconds()
 }
 
+// GetResolutionDuration returns time difference between issue resolution and creation in seconds
+func (issue Issue) GetResolutionDuration() float64 {
+	return issue.Fields.ResolutionDate.Sub(issue.Fields.Created.Time).Seconds()
+}
+
+// Event converts issue to incident event exported with labels and attributed to the deployment which caused it
+func (issue Issue) Event(labels prometheus.Labels) events.Event {
+	event := events.Event{
+		Id:      "jira/" + issue.Key,
+		Type:    events.Incident,
+		Source:  "jira",
+		Time:    issue.Fields.Created.Time,
+		Team:    labels["team"],
+		Project: issue.Fields.Project.Key,
+		Status:  issue.Fields.Status.Name,
+		Labels:  labels,
+	}
+	if event.Team == catalog.UnknownTeam {
+		event.Errors = []string{"catalog: no team for project " + issue.Fields.Project.Key}
+	}
+	if !issue.Fields.ResolutionDate.IsZero() {
+		resolved := issue.Fields.ResolutionDate.Time
+		event.Resolved = &resolved
+	}
+	if known, ok := events.Get(event.Id); ok {
+		event.Deployment, event.Correlation = known.Deployment, known.Correlation
+	}
+	tracker.Correlate(&event, issue.DeploymentLinks())
+	return event
+}
+
 const jiraTime = "2006-01-02T15:04:05.000-0700"
 
 type JiraTime struct {
@@ -51,14 +84,18 @@ type Issue struct {
 			}
 		}
 		// Jira uses non-standard time for created_at
-		Created JiraTime
-		Project struct {
+		Created        JiraTime
+		ResolutionDate JiraTime `json:"resolutiondate"`
+		Project        struct {
 			Key string
 		}
 		IssueType struct {
 			Name string
 		} `json:"issuetype"`
+		Labels []string
 	}
+	// raw fields including custom ones
+	fields map[string]json.RawMessage
 }
 
 func (jtime *JiraTime) UnmarshalJSON(b []byte) (err error) {
@@ -79,7 +116,7 @@ type JiraPayload struct {
 func JiraHandler(w http.ResponseWriter, r *http.Request) {
 	var payload JiraPayload
 	var issue Issue
-	var team string
+	var team, provider string
 	var labels prometheus.Labels
 
 	decoder := json.NewDecoder(r.Body)
@@ -90,15 +127,24 @@ func JiraHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	issue = payload.Issue
-	team = cat.GetTeamNameByProject(issue.Fields.Project.Key)
+	team, provider = catalog.ResolveProject(cat, issue.Fields.Project.Key)
 
 	labels = prometheus.Labels{
 		"team":    team,
 		"project": issue.Fields.Project.Key,
 	}
+	parentTeam, department := catalog.GetParentTeams(cat, team)
+	prom.SetHierarchyLabels(labels, parentTeam, department)
 
 	prom.IncIncidentsCount(labels)
 	prom.AddIncidentsDuration(labels, issue.GetDuration())
+	prom.PushIncident("jira/"+issue.Key, labels, issue.Fields.Created.Time)
+	if !issue.Fields.ResolutionDate.IsZero() {
+		prom.PushRestoreTime("jira/"+issue.Key, labels, issue.Fields.ResolutionDate.Time, issue.GetResolutionDuration())
+	}
+	event := issue.Event(labels)
+	event.Catalog = provider
+	events.Record(event)
 
 	level.Info(logger).Log(
 		"endpoint", "jira",
@@ -0,0 +1,88 @@
+package jira
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+)
+
+var (
+	deploymentField       string
+	deploymentLabelPrefix = "deployment:"
+)
+
+// SetDeploymentLinks sets custom field and label prefix linking incident to the deployment which caused it
+func SetDeploymentLinks(conf config.Jira) {
+	deploymentField = conf.DeploymentField
+	if conf.DeploymentLabelPrefix != "" {
+		deploymentLabelPrefix = conf.DeploymentLabelPrefix
+	}
+}
+
+// UnmarshalJSON keeps raw fields of the issue, custom fields are not known upfront
+func (issue *Issue) UnmarshalJSON(b []byte) error {
+	type plain Issue
+	if err := json.Unmarshal(b, (*plain)(issue)); err != nil {
+		return err
+	}
+	var raw struct {
+		Fields map[string]json.RawMessage
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	issue.fields = raw.Fields
+	return nil
+}
+
+// DeploymentLinks returns deployment ids, SHAs or versions from the deployment field and prefixed labels
+func (issue Issue) DeploymentLinks() []string {
+	var links []string
+	if deploymentField != "" {
+		links = fieldValues(issue.fields[deploymentField])
+	}
+	for _, label := range issue.Fields.Labels {
+		if strings.HasPrefix(label, deploymentLabelPrefix) {
+			links = append(links, strings.TrimPrefix(label, deploymentLabelPrefix))
+		}
+	}
+	return links
+}
+
+// fieldValues flattens text, number, select and multi value fields
+func fieldValues(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil
+	}
+	return flatten(value)
+}
+
+func flatten(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		// text fields may list several deployments
+		return strings.FieldsFunc(v, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			values = append(values, flatten(item)...)
+		}
+		return values
+	case map[string]interface{}:
+		for _, key := range []string{"value", "name", "key"} {
+			if s, ok := v[key]; ok {
+				return flatten(s)
+			}
+		}
+	}
+	return nil
+}
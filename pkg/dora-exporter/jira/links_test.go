@@ -0,0 +1,46 @@
+package jira_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/jira"
+)
+
+func TestDeploymentLinks(t *testing.T) {
+	jira.SetDeploymentLinks(config.Jira{DeploymentField: "customfield_10050", DeploymentLabelPrefix: "deployment:"})
+
+	for _, tc := range []struct {
+		field    string
+		expected []string
+	}{
+		{`"a1b2c3d, v1.2.0"`, []string{"a1b2c3d", "v1.2.0"}},
+		{`42`, []string{"42"}},
+		{`{"id": "10001", "value": "v1.2.0"}`, []string{"v1.2.0"}},
+		{`[{"value": "v1.2.0"}, "a1b2c3d"]`, []string{"v1.2.0", "a1b2c3d"}},
+		{`null`, nil},
+	} {
+		var issue jira.Issue
+		body := `{"key": "INF-1", "fields": {"project": {"key": "INF"}, "labels": ["outage"], "customfield_10050": ` + tc.field + `}}`
+		if err := json.Unmarshal([]byte(body), &issue); err != nil {
+			t.Fatal(err)
+		}
+		if issue.Fields.Project.Key != "INF" {
+			t.Errorf("standard fields aren't decoded: %+v", issue)
+		}
+		if links := issue.DeploymentLinks(); !reflect.DeepEqual(links, tc.expected) {
+			t.Errorf("field %s: expected %v, got %v", tc.field, tc.expected, links)
+		}
+	}
+
+	var issue jira.Issue
+	body := `{"key": "INF-2", "fields": {"labels": ["outage", "deployment:github/release/1"]}}`
+	if err := json.Unmarshal([]byte(body), &issue); err != nil {
+		t.Fatal(err)
+	}
+	if links := issue.DeploymentLinks(); !reflect.DeepEqual(links, []string{"github/release/1"}) {
+		t.Errorf("label link is expected, got %v", links)
+	}
+}
@@ -0,0 +1,161 @@
+// Package opsgenie receives alerts from Opsgenie outgoing webhook integration as incidents
+package opsgenie
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
+)
+
+var logger log.Logger
+
+func SetLogger(log log.Logger) {
+	logger = log
+	return
+}
+
+var cat catalog.TeamsCatalog
+
+func SetCatalog(catalog catalog.TeamsCatalog) {
+	cat = catalog
+	level.Info(logger).Log("opsgenie", "catalog service set")
+}
+
+var (
+	token      string
+	priorities map[string]bool
+)
+
+func SetOpsgenie(conf config.Opsgenie) {
+	token = conf.Token
+	priorities = nil
+	if len(conf.Priorities) > 0 {
+		priorities = map[string]bool{}
+		for _, priority := range conf.Priorities {
+			priorities[priority] = true
+		}
+	}
+}
+
+// EpochTime is Unix time, Opsgenie sends milliseconds or nanoseconds depending on the field
+type EpochTime struct {
+	time.Time
+}
+
+func (t *EpochTime) UnmarshalJSON(b []byte) error {
+	var value int64
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+	switch {
+	case value == 0:
+		t.Time = time.Time{}
+	case value > 1e17:
+		t.Time = time.Unix(0, value)
+	case value > 1e14:
+		t.Time = time.UnixMicro(value)
+	case value > 1e11:
+		t.Time = time.UnixMilli(value)
+	default:
+		t.Time = time.Unix(value, 0)
+	}
+	return nil
+}
+
+type Alert struct {
+	AlertId   string `json:"alertId"`
+	TinyId    string `json:"tinyId"`
+	Message   string
+	Entity    string
+	Priority  string
+	Teams     []string
+	Details   map[string]string
+	CreatedAt EpochTime `json:"createdAt"`
+	UpdatedAt EpochTime `json:"updatedAt"`
+}
+
+// Service returns service the alert is opened for, details.service or entity of the alert
+func (alert Alert) Service() string {
+	if service := alert.Details["service"]; service != "" {
+		return service
+	}
+	return alert.Entity
+}
+
+// Payload is sent by outgoing webhook integration
+type Payload struct {
+	// Create, Acknowledge, Close, AddNote...
+	Action string
+	Alert  Alert
+}
+
+// statuses by action changing the state of the alert
+var statuses = map[string]string{
+	"Create":          "open",
+	"Acknowledge":     "acknowledged",
+	"UnAcknowledge":   "open",
+	"Close":           "closed",
+	"Escalate":        "open",
+	"AssignOwnership": "open",
+}
+
+// NewIncident maps the alert to its service owner, close action resolves the incident
+func NewIncident(payload Payload) tracker.Incident {
+	alert := payload.Alert
+	service := alert.Service()
+	i := tracker.Incident{
+		Id:      "opsgenie/" + alert.AlertId,
+		Source:  "opsgenie",
+		Time:    alert.CreatedAt.Time,
+		Project: service,
+		Status:  statuses[payload.Action],
+	}
+	i.Team, i.Catalog = catalog.ResolveService(cat, service)
+	if i.Time.IsZero() {
+		i.Time = time.Now()
+	}
+	if i.Team == catalog.UnknownTeam {
+		i.Errors = append(i.Errors, "catalog: no team for service "+service)
+	}
+	if payload.Action == "Close" {
+		i.Resolved = alert.UpdatedAt.Time
+		if i.Resolved.IsZero() {
+			i.Resolved = time.Now()
+		}
+	}
+	return i
+}
+
+func OpsgenieHandler(w http.ResponseWriter, r *http.Request) {
+	if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var payload Payload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		level.Error(logger).Log("endpoint", "opsgenie", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// notes, tags and other actions don't change the state of the alert
+	if _, ok := statuses[payload.Action]; !ok || payload.Alert.AlertId == "" {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if priorities != nil && !priorities[payload.Alert.Priority] {
+		level.Debug(logger).Log("endpoint", "opsgenie", "alert", payload.Alert.AlertId, "priority", payload.Alert.Priority, "ignored", "priority")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	tracker.RecordIncident(NewIncident(payload))
+}
@@ -0,0 +1,93 @@
+package opsgenie_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/internal/testenv"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/opsgenie"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var payments = prometheus.Labels{"project": "payments-api", "team": "Payments"}
+
+func setup(t *testing.T) (*events.Store, *prom.Exporter) {
+	store, exporter := testenv.Setup(t, opsgenie.SetLogger)
+
+	opsgenie.SetOpsgenie(config.Opsgenie{Token: "secret", Priorities: []string{"P1", "P2"}})
+	opsgenie.SetCatalog(catalog.NewCatalogFromYaml("- name: Payments\n  services: [payments-api]\n"))
+	return store, exporter
+}
+
+func post(token, body string) int {
+	return testenv.Post(opsgenie.OpsgenieHandler, "/api/opsgenie", body, "Authorization", "Bearer "+token).Code
+}
+
+// alert is created at 10:00 and updated at 12:00, createdAt of the fixture is in milliseconds and updatedAt in nanoseconds
+type alert struct {
+	Action   string
+	Priority string
+}
+
+func TestAlertLifecycle(t *testing.T) {
+	store, exporter := setup(t)
+
+	// reopened and closed again alert keeps the first restore time
+	examples := []alert{
+		{Action: "Create", Priority: "P1"},
+		{Action: "Acknowledge", Priority: "P1"},
+		{Action: "Close", Priority: "P1"},
+		{Action: "Create", Priority: "P1"},
+		{Action: "Close", Priority: "P1"},
+	}
+	for _, example := range examples {
+		if code := post("secret", testenv.Fixture(t, "alert.json", example)); code != http.StatusOK {
+			t.Fatalf("%s: wanted 200 got %d", example.Action, code)
+		}
+	}
+
+	e, ok := store.Get("opsgenie/70413a06-38d6")
+	if !ok {
+		t.Fatal("Wanted incident event")
+	}
+	if e.Team != "Payments" || e.Project != "payments-api" || e.Status != "closed" || e.RestoreTime() != (2*time.Hour).Seconds() {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if got := testenv.Value(t, exporter, "jira_incidents", payments); got != 1 {
+		t.Errorf("Wanted 1 incident got %v", got)
+	}
+	if got := testenv.Value(t, exporter, "jira_incidents_duration_sum", payments); got != (2 * time.Hour).Seconds() {
+		t.Errorf("Wanted 2h restore time got %v", got)
+	}
+}
+
+func TestAlertSkipped(t *testing.T) {
+	store, exporter := setup(t)
+
+	examples := []struct {
+		Name   string
+		Token  string
+		Alert  alert
+		Status int
+	}{
+		{Name: "wrong token", Token: "wrong", Alert: alert{Action: "Create", Priority: "P1"}, Status: http.StatusUnauthorized},
+		{Name: "note", Token: "secret", Alert: alert{Action: "AddNote", Priority: "P1"}, Status: http.StatusAccepted},
+		{Name: "low priority", Token: "secret", Alert: alert{Action: "Create", Priority: "P4"}, Status: http.StatusAccepted},
+	}
+	for _, example := range examples {
+		if code := post(example.Token, testenv.Fixture(t, "alert.json", example.Alert)); code != example.Status {
+			t.Errorf("%s: wanted %d got %d", example.Name, example.Status, code)
+		}
+	}
+	if _, ok := store.Get("opsgenie/70413a06-38d6"); ok {
+		t.Error("Wanted no incident event")
+	}
+	if got := testenv.Value(t, exporter, "jira_incidents", nil); got != 0 {
+		t.Errorf("Wanted no incidents got %v", got)
+	}
+}
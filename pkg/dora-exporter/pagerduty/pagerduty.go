@@ -0,0 +1,144 @@
+// Package pagerduty receives incidents from PagerDuty v3 webhook subscriptions
+package pagerduty
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
+)
+
+var logger log.Logger
+
+func SetLogger(log log.Logger) {
+	logger = log
+	return
+}
+
+var cat catalog.TeamsCatalog
+
+func SetCatalog(catalog catalog.TeamsCatalog) {
+	cat = catalog
+	level.Info(logger).Log("pagerduty", "catalog service set")
+}
+
+var webhookSecret string
+
+func SetPagerDuty(conf config.PagerDuty) {
+	webhookSecret = conf.WebhookSecret
+}
+
+type Reference struct {
+	Id      string
+	Summary string
+}
+
+type Incident struct {
+	Id     string
+	Number int
+	Title  string
+	// triggered, acknowledged or resolved
+	Status    string
+	HtmlUrl   string    `json:"html_url"`
+	CreatedAt time.Time `json:"created_at"`
+	Service   Reference
+	Teams     []Reference
+}
+
+// Payload is sent by v3 webhook subscription
+type Payload struct {
+	Event struct {
+		Id string
+		// incident.triggered, incident.resolved...
+		EventType    string    `json:"event_type"`
+		ResourceType string    `json:"resource_type"`
+		OccurredAt   time.Time `json:"occurred_at"`
+		Data         Incident
+	}
+}
+
+// Resolved reports whether the event resolves the incident
+func (payload Payload) Resolved() bool {
+	return payload.Event.EventType == "incident.resolved"
+}
+
+// validSignature checks X-PagerDuty-Signature when webhook secret is configured,
+// the header lists signatures of all active secrets like v1=<hex>,v1=<hex>
+func validSignature(signatures string, body []byte) bool {
+	if webhookSecret == "" {
+		return true
+	}
+	mac := hmac.New(sha256.New, []byte(webhookSecret))
+	mac.Write(body)
+	expected := "v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	for _, signature := range strings.Split(signatures, ",") {
+		if hmac.Equal([]byte(strings.TrimSpace(signature)), []byte(expected)) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewIncident maps incident of the event to its service owner, resolve time is set by incident.resolved event
+func NewIncident(payload Payload) tracker.Incident {
+	data := payload.Event.Data
+	i := tracker.Incident{
+		Id:      "pagerduty/" + data.Id,
+		Source:  "pagerduty",
+		Time:    data.CreatedAt,
+		Project: data.Service.Summary,
+		Status:  data.Status,
+	}
+	i.Team, i.Catalog = catalog.ResolveService(cat, data.Service.Summary)
+	if i.Time.IsZero() {
+		i.Time = payload.Event.OccurredAt
+	}
+	if i.Team == catalog.UnknownTeam {
+		i.Errors = append(i.Errors, "catalog: no team for service "+data.Service.Summary)
+	}
+	if payload.Resolved() {
+		i.Resolved = payload.Event.OccurredAt
+		if i.Resolved.IsZero() {
+			i.Resolved = time.Now()
+		}
+	}
+	return i
+}
+
+func PagerDutyHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validSignature(r.Header.Get("X-PagerDuty-Signature"), body) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var payload Payload
+	if err = json.Unmarshal(body, &payload); err != nil {
+		level.Error(logger).Log("endpoint", "pagerduty", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// pings and events of other resources like services
+	if payload.Event.ResourceType != "incident" || payload.Event.Data.Id == "" {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	tracker.RecordIncident(NewIncident(payload))
+}
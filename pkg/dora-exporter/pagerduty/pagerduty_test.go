@@ -0,0 +1,107 @@
+package pagerduty_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/internal/testenv"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/pagerduty"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const secret = "webhook-secret"
+
+func setup(t *testing.T) (*events.Store, *prom.Exporter) {
+	store, exporter := testenv.Setup(t, pagerduty.SetLogger)
+
+	pagerduty.SetPagerDuty(config.PagerDuty{WebhookSecret: secret})
+	pagerduty.SetCatalog(catalog.NewCatalogFromYaml("- name: Payments\n  services: [Payments API]\n"))
+	return store, exporter
+}
+
+func post(body, signature string) int {
+	if signature == "" {
+		signature = "v1=deadbeef, v1=" + testenv.Sign(secret, body)
+	}
+	return testenv.Post(pagerduty.PagerDutyHandler, "/api/pagerduty", body, "X-PagerDuty-Signature", signature).Code
+}
+
+type incident struct {
+	Type       string
+	Status     string
+	OccurredAt string
+}
+
+func TestIncidentLifecycle(t *testing.T) {
+	store, exporter := setup(t)
+
+	examples := []incident{
+		{Type: "incident.triggered", Status: "triggered", OccurredAt: "2021-04-28T10:00:01Z"},
+		{Type: "incident.acknowledged", Status: "acknowledged", OccurredAt: "2021-04-28T10:05:00Z"},
+		{Type: "incident.resolved", Status: "resolved", OccurredAt: "2021-04-28T12:00:00Z"},
+		// retried delivery doesn't add restore time twice
+		{Type: "incident.resolved", Status: "resolved", OccurredAt: "2021-04-28T12:00:00Z"},
+		// neither does resolving reopened incident
+		{Type: "incident.reopened", Status: "triggered", OccurredAt: "2021-04-28T13:00:00Z"},
+		{Type: "incident.resolved", Status: "resolved", OccurredAt: "2021-04-28T14:00:00Z"},
+	}
+	for _, example := range examples {
+		if code := post(testenv.Fixture(t, "incident.json", example), ""); code != http.StatusOK {
+			t.Fatalf("%s: wanted 200 got %d", example.Type, code)
+		}
+	}
+
+	e, ok := store.Get("pagerduty/PGR0VU2")
+	if !ok {
+		t.Fatal("Wanted incident event")
+	}
+	if e.Team != "Payments" || e.Project != "Payments API" || e.Status != "resolved" || e.RestoreTime() != (2*time.Hour).Seconds() {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	expected := `
+# HELP jira_incidents The amount of incidents.
+# TYPE jira_incidents counter
+jira_incidents{project="Payments API",team="Payments"} 1
+# HELP jira_incidents_duration_sum The amount of incidents.
+# TYPE jira_incidents_duration_sum gauge
+jira_incidents_duration_sum{project="Payments API",team="Payments"} 7200
+`
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "jira_incidents", "jira_incidents_duration_sum"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInvalidSignature(t *testing.T) {
+	_, exporter := setup(t)
+
+	examples := []struct {
+		Name      string
+		Body      string
+		Signature string
+		Status    int
+	}{
+		{
+			Name:      "wrong signature",
+			Body:      testenv.Fixture(t, "incident.json", incident{Type: "incident.triggered", Status: "triggered", OccurredAt: "2021-04-28T10:00:01Z"}),
+			Signature: "v1=deadbeef",
+			Status:    http.StatusUnauthorized,
+		},
+		{Name: "ping", Body: testenv.Fixture(t, "ping.json", nil), Status: http.StatusAccepted},
+	}
+	for _, example := range examples {
+		if code := post(example.Body, example.Signature); code != example.Status {
+			t.Errorf("%s: wanted %d got %d", example.Name, example.Status, code)
+		}
+	}
+	if got := testenv.Value(t, exporter, "jira_incidents", prometheus.Labels{"team": "Payments"}); got != 0 {
+		t.Errorf("Wanted no incidents got %v", got)
+	}
+}
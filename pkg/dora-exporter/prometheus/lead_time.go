@@ -0,0 +1,162 @@
+package prometheus
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+const leadTimeName = "github_deployments_lead_time_seconds"
+
+// restoredHistogram is lead time histogram loaded from the metrics file,
+// client histograms can't be set so it is added to the live one on collect
+type restoredHistogram struct {
+	labelValues []string
+	count       uint64
+	sum         float64
+	// cumulative counts by upper bound
+	buckets map[float64]uint64
+}
+
+// countAt returns cumulative count of observations not greater than bound
+func (h restoredHistogram) countAt(bound float64) uint64 {
+	var count uint64
+	best := math.Inf(-1)
+	for upper, c := range h.buckets {
+		if upper <= bound && upper > best {
+			best, count = upper, c
+		}
+	}
+	return count
+}
+
+func leadTimeKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// labelValues returns values of metric labels ordered by names
+func labelValues(pairs []*io_prometheus_client.LabelPair, names []string) []string {
+	labels := make(prometheus.Labels, len(pairs))
+	for _, pair := range pairs {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = labels[name]
+	}
+	return values
+}
+
+// restoreLeadTime adds histogram loaded from the metrics file, histograms which end up
+// with the same labels after normalization are summed
+func (e *Exporter) restoreLeadTime(metric *io_prometheus_client.Metric) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	values := labelValues(metric.GetLabel(), e.github_labels)
+	key := leadTimeKey(values)
+	restored, ok := e.lead_time_restored[key]
+	if !ok {
+		restored = restoredHistogram{labelValues: values, buckets: map[float64]uint64{}}
+	}
+
+	histogram := metric.GetHistogram()
+	restored.count += histogram.GetSampleCount()
+	restored.sum += histogram.GetSampleSum()
+	for _, bucket := range histogram.GetBucket() {
+		if math.IsInf(bucket.GetUpperBound(), 1) {
+			continue
+		}
+		restored.buckets[bucket.GetUpperBound()] += bucket.GetCumulativeCount()
+	}
+	e.lead_time_restored[key] = restored
+
+	_ = level.Debug(logger).Log("import", "histogram", "name", leadTimeName, "count", restored.count)
+}
+
+// collectLeadTime sends live lead time histograms with restored observations added
+func (e *Exporter) collectLeadTime(ch chan<- prometheus.Metric) {
+	live := make(chan prometheus.Metric)
+	go func() {
+		e.deployments_lead_time.Collect(live)
+		close(live)
+	}()
+
+	merged := map[string]bool{}
+	for m := range live {
+		var metric io_prometheus_client.Metric
+		if err := m.Write(&metric); err != nil {
+			ch <- m
+			continue
+		}
+		key := leadTimeKey(labelValues(metric.GetLabel(), e.github_labels))
+		restored, ok := e.lead_time_restored[key]
+		if !ok {
+			ch <- m
+			continue
+		}
+		merged[key] = true
+		ch <- restored.merge(m.Desc(), metric.GetHistogram())
+	}
+
+	for key, restored := range e.lead_time_restored {
+		if !merged[key] {
+			ch <- restored.merge(e.lead_time_desc, &io_prometheus_client.Histogram{})
+		}
+	}
+}
+
+// merge returns histogram with observations of live one added, exemplars of live buckets are kept
+func (h restoredHistogram) merge(desc *prometheus.Desc, live *io_prometheus_client.Histogram) prometheus.Metric {
+	bounds := map[float64]bool{}
+	for bound := range h.buckets {
+		bounds[bound] = true
+	}
+	liveCounts := map[float64]uint64{}
+	var exemplars []prometheus.Exemplar
+	for _, bucket := range live.GetBucket() {
+		bounds[bucket.GetUpperBound()] = true
+		liveCounts[bucket.GetUpperBound()] = bucket.GetCumulativeCount()
+		if exemplar := bucket.GetExemplar(); exemplar != nil {
+			labels := prometheus.Labels{}
+			for _, pair := range exemplar.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			e := prometheus.Exemplar{Value: exemplar.GetValue(), Labels: labels}
+			if exemplar.GetTimestamp() != nil {
+				e.Timestamp = exemplar.GetTimestamp().AsTime()
+			}
+			exemplars = append(exemplars, e)
+		}
+	}
+
+	sorted := make([]float64, 0, len(bounds))
+	for bound := range bounds {
+		sorted = append(sorted, bound)
+	}
+	sort.Float64s(sorted)
+
+	buckets := make(map[float64]uint64, len(sorted))
+	var liveCount uint64
+	for _, bound := range sorted {
+		// live buckets are cumulative as well, bounds missing in live histogram keep the previous count
+		if c, ok := liveCounts[bound]; ok {
+			liveCount = c
+		}
+		buckets[bound] = h.countAt(bound) + liveCount
+	}
+
+	metric := prometheus.MustNewConstHistogram(desc, h.count+live.GetSampleCount(), h.sum+live.GetSampleSum(), buckets, h.labelValues...)
+	if len(exemplars) == 0 {
+		return metric
+	}
+	withExemplars, err := prometheus.NewMetricWithExemplars(metric, exemplars...)
+	if err != nil {
+		return metric
+	}
+	return withExemplars
+}
@@ -3,6 +3,7 @@ package prometheus
 import (
 	"os"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -16,8 +17,16 @@ type Exporter struct {
 	deployments_count        *prometheus.CounterVec
 	deployments_duration     *prometheus.GaugeVec
 	deployments_duration_sum *prometheus.GaugeVec
+	deployments_lead_time    *prometheus.HistogramVec
+	lead_time_desc           *prometheus.Desc
+	lead_time_restored       map[string]restoredHistogram
+	deployments_failed       *prometheus.CounterVec
 	incidents_count          *prometheus.CounterVec
 	incidents_duration_sum   *prometheus.GaugeVec
+	// label names of the metrics, with hierarchy labels when enabled
+	jira_labels   []string
+	github_labels []string
+	failed_labels []string
 }
 
 var logger log.Logger
@@ -40,6 +49,8 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 	e.deployments_count.Collect(ch)
 	e.deployments_duration.Collect(ch)
 	e.deployments_duration_sum.Collect(ch)
+	e.collectLeadTime(ch)
+	e.deployments_failed.Collect(ch)
 	e.incidents_count.Collect(ch)
 	e.incidents_duration_sum.Collect(ch)
 }
@@ -48,6 +59,8 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	e.deployments_count.Describe(ch)
 	e.deployments_duration.Describe(ch)
 	e.deployments_duration_sum.Describe(ch)
+	e.deployments_lead_time.Describe(ch)
+	e.deployments_failed.Describe(ch)
 	e.incidents_count.Describe(ch)
 	e.incidents_duration_sum.Describe(ch)
 }
@@ -55,80 +68,164 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 var JiraLabels = []string{"project", "team"}
 var GithubLabels = []string{"repo", "environment", "team", "status"}
 
+// FailedLabels label deployments attributed as failed changes by reason, e.g. incident
+var FailedLabels = []string{"repo", "environment", "team", "reason"}
+
+// HierarchyLabels are added to all metrics when team hierarchy is enabled
+var HierarchyLabels = []string{"parent_team", "department"}
+
+var hierarchy bool
+
+// EnableHierarchyLabels adds parent_team and department labels to all metrics,
+// must be called before NewExporter
+func EnableHierarchyLabels() {
+	hierarchy = true
+}
+
+// withHierarchy returns names followed by hierarchy labels when enabled
+func withHierarchy(names []string) []string {
+	if !hierarchy {
+		return names
+	}
+	labels := make([]string, 0, len(names)+len(HierarchyLabels))
+	labels = append(labels, names...)
+	return append(labels, HierarchyLabels...)
+}
+
+// SetHierarchyLabels sets parent_team and department labels when hierarchy is enabled
+func SetHierarchyLabels(labels prometheus.Labels, parentTeam, department string) {
+	if !hierarchy {
+		return
+	}
+	labels["parent_team"] = parentTeam
+	labels["department"] = department
+}
+
+// normalizeLabels fits labels to names, missing labels are set empty and unknown are dropped,
+// so metrics saved before the label set has changed can still be imported
+func normalizeLabels(labels prometheus.Labels, names []string) prometheus.Labels {
+	normalized := make(prometheus.Labels, len(names))
+	for _, name := range names {
+		normalized[name] = labels[name]
+	}
+	return normalized
+}
+
+// LeadTimeBuckets span from an hour to a quarter
+var LeadTimeBuckets = []float64{3600, 6 * 3600, 24 * 3600, 2 * 24 * 3600, 7 * 24 * 3600, 14 * 24 * 3600, 30 * 24 * 3600, 90 * 24 * 3600}
+
 func NewExporter() *Exporter {
+	jiraLabels, githubLabels, failedLabels := withHierarchy(JiraLabels), withHierarchy(GithubLabels), withHierarchy(FailedLabels)
 	return &Exporter{
 		deployments_count: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Namespace: "github",
 			Name:      "deployments_total",
 			Help:      "The amount of successful deployments.",
-		}, GithubLabels),
+		}, githubLabels),
 		deployments_duration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: "github",
 			Name:      "deployments_duration",
 			Help:      "The last deployments duration",
-		}, GithubLabels),
+		}, githubLabels),
 		deployments_duration_sum: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: "github",
 			Name:      "deployments_duration_sum",
 			Help:      "The last deployments duration sum",
-		}, GithubLabels),
+		}, githubLabels),
+		deployments_lead_time: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "github",
+			Name:      "deployments_lead_time_seconds",
+			Help:      "The lead time from the first commit to deployment.",
+			Buckets:   LeadTimeBuckets,
+		}, githubLabels),
+		lead_time_desc:     prometheus.NewDesc(leadTimeName, "The lead time from the first commit to deployment.", githubLabels, nil),
+		lead_time_restored: map[string]restoredHistogram{},
+		deployments_failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "github",
+			Name:      "deployments_failed_total",
+			Help:      "The amount of deployments attributed as failed changes.",
+		}, failedLabels),
 		incidents_duration_sum: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: "jira",
 			Name:      "incidents_duration_sum",
 			Help:      "The amount of incidents."},
-			JiraLabels,
+			jiraLabels,
 		),
 		incidents_count: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Namespace: "jira",
 			Name:      "incidents",
 			Help:      "The amount of incidents.",
-		}, JiraLabels),
+		}, jiraLabels),
+		jira_labels:   jiraLabels,
+		github_labels: githubLabels,
+		failed_labels: failedLabels,
 	}
 }
 
-// UpdateCounter resets counter and increments using value from metric
-func UpdateCounter(counter *prometheus.CounterVec, metric *io_prometheus_client.Metric) {
+// UpdateCounter increments counter by value from metric, metrics which end up
+// with the same labels after normalization are summed
+func UpdateCounter(counter *prometheus.CounterVec, names []string, metric *io_prometheus_client.Metric) {
 	var labels prometheus.Labels = make(map[string]string)
 	var value float64
 	for _, labelPair := range metric.GetLabel() {
 		labels[*labelPair.Name] = *labelPair.Value
 		_ = level.Debug(logger).Log("import", "counter", "label", *labelPair.Name, "value", *labelPair.Value)
 	}
+	labels = normalizeLabels(labels, names)
 	value = metric.GetCounter().GetValue()
 
 	_ = level.Debug(logger).Log("import", "counter", "counter_value", value)
-	counter.Delete(labels) // Reset the counter
 	counter.With(labels).Add(value)
 }
 
 // UpdateGauge sets gauge to value from metric
-func UpdateGauge(gauge *prometheus.GaugeVec, metric *io_prometheus_client.Metric) {
+func UpdateGauge(gauge *prometheus.GaugeVec, names []string, metric *io_prometheus_client.Metric) {
+	updateGauge(gauge, names, metric, false)
+}
+
+// SumGauge adds value from metric to gauge, used for gauges holding sums
+func SumGauge(gauge *prometheus.GaugeVec, names []string, metric *io_prometheus_client.Metric) {
+	updateGauge(gauge, names, metric, true)
+}
+
+func updateGauge(gauge *prometheus.GaugeVec, names []string, metric *io_prometheus_client.Metric, sum bool) {
 	var labels prometheus.Labels = make(map[string]string)
 	for _, labelPair := range metric.GetLabel() {
 		labels[labelPair.GetName()] = labelPair.GetValue()
 		_ = level.Debug(logger).Log("import", "gauge", "label", *labelPair.Name, "value", *labelPair.Value)
 	}
+	labels = normalizeLabels(labels, names)
 
 	_ = level.Debug(logger).Log("import", "gauge", "gauge_value", metric.GetGauge().GetValue())
+	if sum {
+		gauge.With(labels).Add(metric.GetGauge().GetValue())
+		return
+	}
 	gauge.With(labels).Set(metric.GetGauge().GetValue())
 }
 
 func (e *Exporter) Update(family string, metric *io_prometheus_client.Metric) {
 	switch family {
 	case "jira_incidents_duration_sum":
-		UpdateGauge(exp.incidents_duration_sum, metric)
+		SumGauge(exp.incidents_duration_sum, e.jira_labels, metric)
 
 	case "github_deployments_duration":
-		UpdateGauge(exp.deployments_duration, metric)
+		UpdateGauge(exp.deployments_duration, e.github_labels, metric)
 
 	case "github_deployments_duration_sum":
-		UpdateGauge(exp.deployments_duration_sum, metric)
+		SumGauge(exp.deployments_duration_sum, e.github_labels, metric)
 
 	case "jira_incidents":
-		UpdateCounter(exp.incidents_count, metric)
+		UpdateCounter(exp.incidents_count, e.jira_labels, metric)
 
 	case "github_deployments_total":
-		UpdateCounter(exp.deployments_count, metric)
+		UpdateCounter(exp.deployments_count, e.github_labels, metric)
+
+	case "github_deployments_failed_total":
+		UpdateCounter(exp.deployments_failed, e.failed_labels, metric)
+
+	case leadTimeName:
+		exp.restoreLeadTime(metric)
 	}
 }
 
@@ -173,17 +270,61 @@ func AddIncidentsDuration(labels prometheus.Labels, duration float64) {
 	_ = level.Debug(logger).Log("gauge", "incidents_duration_sum", "action", "set", "value", duration)
 }
 
-func IncDeploymentsCount(labels prometheus.Labels) {
-	exp.deployments_count.With(labels).Inc()
+// Length of abbreviated sha in exemplars
+const exemplarShaLength = 12
+
+// NewExemplar builds exemplar labels from name and value pairs in order of importance.
+// Sha is abbreviated, empty values and pairs exceeding exemplar length limit are skipped.
+func NewExemplar(pairs ...string) prometheus.Labels {
+	exemplar := prometheus.Labels{}
+	runes := 0
+	for i := 0; i+1 < len(pairs); i += 2 {
+		name, value := pairs[i], pairs[i+1]
+		if name == "sha" && len(value) > exemplarShaLength {
+			value = value[:exemplarShaLength]
+		}
+		length := utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+		if value == "" || runes+length > prometheus.ExemplarMaxRunes {
+			continue
+		}
+		exemplar[name] = value
+		runes += length
+	}
+	return exemplar
+}
+
+// IncDeploymentsCount increments deployments counter, exemplar is attached when not empty
+func IncDeploymentsCount(labels prometheus.Labels, exemplar prometheus.Labels) {
+	counter := exp.deployments_count.With(labels)
+	if adder, ok := counter.(prometheus.ExemplarAdder); ok && len(exemplar) > 0 {
+		adder.AddWithExemplar(1, exemplar)
+	} else {
+		counter.Inc()
+	}
 
 	_ = level.Debug(logger).Log("counter", "deployments_count", "action", "inc")
 }
 
-func AddDeploymentsDuration(labels prometheus.Labels, duration float64) {
+// IncDeploymentsFailed counts deployment attributed as failed change
+func IncDeploymentsFailed(labels prometheus.Labels) {
+	exp.deployments_failed.With(labels).Inc()
+	_ = level.Debug(logger).Log("counter", "deployments_failed", "action", "inc", "reason", labels["reason"])
+}
+
+// AddDeploymentsDuration sets the last lead time and observes it in lead time histogram,
+// exemplar is attached to the observation when not empty
+func AddDeploymentsDuration(labels prometheus.Labels, duration float64, exemplar prometheus.Labels) {
 
 	exp.deployments_duration.With(labels).Set(duration)
 
 	_ = level.Debug(logger).Log("counter", "deployments_duration", "action", "set", "value", duration)
 
 	exp.deployments_duration_sum.With(labels).Add(duration)
+
+	histogram := exp.deployments_lead_time.With(labels)
+	if observer, ok := histogram.(prometheus.ExemplarObserver); ok && len(exemplar) > 0 {
+		observer.ObserveWithExemplar(duration, exemplar)
+	} else {
+		histogram.Observe(duration)
+	}
 }
@@ -0,0 +1,142 @@
+package prometheus_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestNewExemplar(t *testing.T) {
+	sha := "4678358ceb36e4db10dc7c8ca2ad38aab33941ba"
+	url := "https://api.github.com/repos/mprokopov/dora-exporter/deployments/1234567890"
+
+	exemplar := prom.NewExemplar(
+		"deployment_url", url,
+		"sha", sha,
+		"deployment_id", "1234567890",
+		"release_id", "",
+		"pull_request", "123",
+	)
+
+	if exemplar["deployment_url"] != url || exemplar["deployment_id"] != "1234567890" {
+		t.Errorf("Wanted deployment_url and deployment_id in exemplar got %v", exemplar)
+	}
+	if exemplar["sha"] != sha[:12] {
+		t.Errorf("Wanted abbreviated sha got %v", exemplar)
+	}
+	if _, ok := exemplar["release_id"]; ok {
+		t.Errorf("Wanted empty release_id to be skipped got %v", exemplar)
+	}
+	if _, ok := exemplar["pull_request"]; ok {
+		t.Errorf("Wanted pull_request exceeding the limit to be skipped got %v", exemplar)
+	}
+}
+
+func TestRestoreLeadTime(t *testing.T) {
+	prom.SetLogger(log.NewNopLogger())
+	exporter := prom.NewExporter()
+	prom.SetExporter(exporter)
+
+	metrics := filepath.Join(t.TempDir(), "metrics.txt")
+	saved := `# HELP github_deployments_lead_time_seconds The lead time from the first commit to deployment.
+# TYPE github_deployments_lead_time_seconds histogram
+github_deployments_lead_time_seconds_bucket{environment="production",repo="api",status="success",team="Infra",le="3600"} 1
+github_deployments_lead_time_seconds_bucket{environment="production",repo="api",status="success",team="Infra",le="21600"} 2
+github_deployments_lead_time_seconds_bucket{environment="production",repo="api",status="success",team="Infra",le="+Inf"} 2
+github_deployments_lead_time_seconds_sum{environment="production",repo="api",status="success",team="Infra"} 7200
+github_deployments_lead_time_seconds_count{environment="production",repo="api",status="success",team="Infra"} 2
+`
+	if err := os.WriteFile(metrics, []byte(saved), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := prom.LoadMetricsFromFile(metrics); err != nil {
+		t.Fatal(err)
+	}
+	prom.AddDeploymentsDuration(prometheus.Labels{"repo": "api", "environment": "production", "team": "Infra", "status": "success"}, 1800, nil)
+
+	expected := `
+# HELP github_deployments_lead_time_seconds The lead time from the first commit to deployment.
+# TYPE github_deployments_lead_time_seconds histogram
+github_deployments_lead_time_seconds_bucket{environment="production",repo="api",status="success",team="Infra",le="3600"} 2
+github_deployments_lead_time_seconds_bucket{environment="production",repo="api",status="success",team="Infra",le="21600"} 3
+github_deployments_lead_time_seconds_bucket{environment="production",repo="api",status="success",team="Infra",le="86400"} 3
+github_deployments_lead_time_seconds_bucket{environment="production",repo="api",status="success",team="Infra",le="172800"} 3
+github_deployments_lead_time_seconds_bucket{environment="production",repo="api",status="success",team="Infra",le="604800"} 3
+github_deployments_lead_time_seconds_bucket{environment="production",repo="api",status="success",team="Infra",le="1.2096e+06"} 3
+github_deployments_lead_time_seconds_bucket{environment="production",repo="api",status="success",team="Infra",le="2.592e+06"} 3
+github_deployments_lead_time_seconds_bucket{environment="production",repo="api",status="success",team="Infra",le="7.776e+06"} 3
+github_deployments_lead_time_seconds_bucket{environment="production",repo="api",status="success",team="Infra",le="+Inf"} 3
+github_deployments_lead_time_seconds_sum{environment="production",repo="api",status="success",team="Infra"} 9000
+github_deployments_lead_time_seconds_count{environment="production",repo="api",status="success",team="Infra"} 3
+`
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "github_deployments_lead_time_seconds"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateCounterLabelsChanged(t *testing.T) {
+	prom.SetLogger(log.NewNopLogger())
+	names := append([]string{"project", "team"}, prom.HierarchyLabels...)
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "incidents"}, names)
+
+	// saved before hierarchy labels were enabled, with a label removed since then
+	metric := &io_prometheus_client.Metric{
+		Label: []*io_prometheus_client.LabelPair{
+			{Name: proto.String("project"), Value: proto.String("PAY")},
+			{Name: proto.String("team"), Value: proto.String("payments")},
+			{Name: proto.String("obsolete"), Value: proto.String("x")},
+		},
+		Counter: &io_prometheus_client.Counter{Value: proto.Float64(3)},
+	}
+	prom.UpdateCounter(counter, names, metric)
+
+	got := testutil.ToFloat64(counter.With(prometheus.Labels{"project": "PAY", "team": "payments", "parent_team": "", "department": ""}))
+	if got != 3 {
+		t.Errorf("Wanted 3 got %v", got)
+	}
+}
+
+func TestLoadMetricsCollapsedLabels(t *testing.T) {
+	prom.SetLogger(log.NewNopLogger())
+	exporter := prom.NewExporter()
+	prom.SetExporter(exporter)
+
+	// obsolete label is dropped, both series end up with the same labels
+	metrics := filepath.Join(t.TempDir(), "metrics.txt")
+	saved := `# HELP jira_incidents The amount of incidents.
+# TYPE jira_incidents counter
+jira_incidents{obsolete="a",project="PAY",team="payments"} 2
+jira_incidents{obsolete="b",project="PAY",team="payments"} 3
+# HELP jira_incidents_duration_sum The amount of incidents.
+# TYPE jira_incidents_duration_sum gauge
+jira_incidents_duration_sum{obsolete="a",project="PAY",team="payments"} 600
+jira_incidents_duration_sum{obsolete="b",project="PAY",team="payments"} 1200
+`
+	if err := os.WriteFile(metrics, []byte(saved), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := prom.LoadMetricsFromFile(metrics); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP jira_incidents The amount of incidents.
+# TYPE jira_incidents counter
+jira_incidents{project="PAY",team="payments"} 5
+# HELP jira_incidents_duration_sum The amount of incidents.
+# TYPE jira_incidents_duration_sum gauge
+jira_incidents_duration_sum{project="PAY",team="payments"} 1800
+`
+	if err := testutil.CollectAndCompare(exporter, strings.NewReader(expected), "jira_incidents", "jira_incidents_duration_sum"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,252 @@
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const defaultRemoteWriteTimeout = 15 * time.Second
+
+// Pushed samples waiting for the endpoint, new ones are dropped when the queue is full
+const remoteWriteQueueSize = 1000
+
+// Sample is a single value of the series pushed with the time the event happened
+type Sample struct {
+	Name      string
+	Labels    prometheus.Labels
+	Value     float64
+	Timestamp time.Time
+}
+
+// RemoteWriter pushes samples to Prometheus remote-write compatible endpoint
+type RemoteWriter struct {
+	Endpoint url.URL
+
+	Username, Password, BearerToken string
+	Headers                         map[string]string
+
+	client  http.Client
+	queue   chan []Sample
+	done    chan struct{}
+	stopped sync.Once
+}
+
+var remoteWriter *RemoteWriter
+
+func SetRemoteWriter(w *RemoteWriter) {
+	remoteWriter = w
+}
+
+func NewRemoteWriter(conf config.RemoteWrite) (*RemoteWriter, error) {
+	u, err := url.Parse(conf.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = defaultRemoteWriteTimeout
+	}
+
+	level.Info(logger).Log("remote_write", "enabled", "endpoint", u.Redacted())
+
+	return &RemoteWriter{
+		Endpoint:    *u,
+		Username:    conf.Username,
+		Password:    conf.Password,
+		BearerToken: conf.BearerToken,
+		Headers:     conf.Headers,
+		client:      http.Client{Timeout: timeout},
+		queue:       make(chan []Sample, remoteWriteQueueSize),
+		done:        make(chan struct{}),
+	}, nil
+}
+
+// Start sends queued samples in background until Stop is called
+func (w *RemoteWriter) Start() {
+	go func() {
+		defer close(w.done)
+		for samples := range w.queue {
+			// queued meanwhile samples are sent in one request
+			for pending := true; pending; {
+				select {
+				case more, ok := <-w.queue:
+					if ok {
+						samples = append(samples, more...)
+					} else {
+						pending = false
+					}
+				default:
+					pending = false
+				}
+			}
+			if err := w.Write(samples); err != nil {
+				_ = level.Error(logger).Log("remote_write", "push", "samples", len(samples), "error", err)
+			}
+		}
+	}()
+}
+
+// Stop sends samples left in the queue and waits for the background writer started by Start
+func (w *RemoteWriter) Stop() {
+	w.stopped.Do(func() {
+		close(w.queue)
+		<-w.done
+	})
+}
+
+// Enqueue schedules samples for the background writer without waiting for the endpoint
+func (w *RemoteWriter) Enqueue(samples []Sample) {
+	select {
+	case w.queue <- samples:
+	default:
+		_ = level.Error(logger).Log("remote_write", "queue", "samples", len(samples), "error", "queue is full, samples dropped")
+	}
+}
+
+// Write sends samples using remote-write protocol 1.0
+func (w *RemoteWriter) Write(samples []Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	body := snappy.Encode(nil, EncodeWriteRequest(samples))
+
+	req, err := http.NewRequest(http.MethodPost, w.Endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "dora-exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	for name, value := range w.Headers {
+		req.Header.Set(name, value)
+	}
+	if w.Username != "" {
+		req.SetBasicAuth(w.Username, w.Password)
+	} else if w.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.BearerToken)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote write: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	_ = level.Debug(logger).Log("remote_write", "pushed", "samples", len(samples))
+	return nil
+}
+
+// EncodeWriteRequest marshals samples into prometheus.WriteRequest protobuf message,
+// one time series per sample.
+func EncodeWriteRequest(samples []Sample) []byte {
+	var request []byte
+
+	for _, sample := range samples {
+		names := make([]string, 0, len(sample.Labels))
+		for name := range sample.Labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		// labels must be sorted by name, __name__ goes first
+		var series []byte
+		series = protowire.AppendTag(series, 1, protowire.BytesType)
+		series = protowire.AppendBytes(series, encodeLabel("__name__", sample.Name))
+		for _, name := range names {
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, encodeLabel(name, sample.Labels[name]))
+		}
+
+		var value []byte
+		value = protowire.AppendTag(value, 1, protowire.Fixed64Type)
+		value = protowire.AppendFixed64(value, math.Float64bits(sample.Value))
+		value = protowire.AppendTag(value, 2, protowire.VarintType)
+		value = protowire.AppendVarint(value, uint64(sample.Timestamp.UnixMilli()))
+
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, value)
+
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, series)
+	}
+
+	return request
+}
+
+func encodeLabel(name, value string) []byte {
+	var label []byte
+	label = protowire.AppendTag(label, 1, protowire.BytesType)
+	label = protowire.AppendString(label, name)
+	label = protowire.AppendTag(label, 2, protowire.BytesType)
+	label = protowire.AppendString(label, value)
+	return label
+}
+
+// Series pushed once per event, every event has its own series identified by id label,
+// so samples stamped with the event time never arrive out of order
+const (
+	deploymentEventName  = "dora_deployment"
+	leadTimeEventName    = "dora_deployment_lead_time_seconds"
+	incidentEventName    = "dora_incident"
+	restoreTimeEventName = "dora_incident_restore_seconds"
+	eventIdLabel         = "id"
+)
+
+// pushEvent queues a single sample of the event series stamped with the event time, current time when unknown
+func pushEvent(name, id string, labels prometheus.Labels, value float64, at time.Time) {
+	if remoteWriter == nil {
+		return
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	eventLabels := make(prometheus.Labels, len(labels)+1)
+	for name, value := range labels {
+		eventLabels[name] = value
+	}
+	eventLabels[eventIdLabel] = id
+	remoteWriter.Enqueue([]Sample{{Name: name, Labels: eventLabels, Value: value, Timestamp: at}})
+}
+
+// PushDeployment queues deployment sample with value 1 stamped with the time deployment happened
+func PushDeployment(id string, labels prometheus.Labels, at time.Time) {
+	pushEvent(deploymentEventName, id, labels, 1, at)
+}
+
+// PushLeadTime queues lead time of the deployment in seconds stamped with the time deployment happened
+func PushLeadTime(id string, labels prometheus.Labels, at time.Time, leadTime float64) {
+	pushEvent(leadTimeEventName, id, labels, leadTime, at)
+}
+
+// PushIncident queues incident sample with value 1 stamped with the time incident was created
+func PushIncident(id string, labels prometheus.Labels, at time.Time) {
+	pushEvent(incidentEventName, id, labels, 1, at)
+}
+
+// PushRestoreTime queues restore time of the incident in seconds stamped with the time incident was resolved
+func PushRestoreTime(id string, labels prometheus.Labels, at time.Time, restoreTime float64) {
+	pushEvent(restoreTimeEventName, id, labels, restoreTime, at)
+}
@@ -0,0 +1,210 @@
+package prometheus_test
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/config"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type decodedSample struct {
+	Labels    []string
+	Value     float64
+	Timestamp int64
+}
+
+// fields returns protobuf fields of the message as number and raw value pairs
+func fields(t *testing.T, b []byte) (numbers []protowire.Number, values [][]byte) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+		var value []byte
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		case protowire.Fixed64Type:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			value = b[:n]
+		case protowire.VarintType:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			value = b[:n]
+		}
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+		numbers = append(numbers, num)
+		values = append(values, value)
+	}
+	return
+}
+
+func decodeWriteRequest(t *testing.T, b []byte) []decodedSample {
+	var samples []decodedSample
+
+	_, series := fields(t, b)
+	for _, s := range series {
+		var sample decodedSample
+		numbers, values := fields(t, s)
+		for i, num := range numbers {
+			switch num {
+			case 1:
+				_, label := fields(t, values[i])
+				sample.Labels = append(sample.Labels, string(label[0])+"="+string(label[1]))
+			case 2:
+				_, v := fields(t, values[i])
+				bits, _ := protowire.ConsumeFixed64(v[0])
+				ts, _ := protowire.ConsumeVarint(v[1])
+				sample.Value = math.Float64frombits(bits)
+				sample.Timestamp = int64(ts)
+			}
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+func TestRemoteWriterWrite(t *testing.T) {
+	prom.SetLogger(log.NewLogfmtLogger(os.Stderr))
+
+	at := time.Date(2022, 9, 15, 5, 57, 2, 0, time.UTC)
+	var got []decodedSample
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		compressed, _ := io.ReadAll(r.Body)
+		body, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got = decodeWriteRequest(t, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	writer, err := prom.NewRemoteWriter(config.RemoteWrite{Url: server.URL, BearerToken: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writer.Write([]prom.Sample{{
+		Name:      "github_deployments_total",
+		Labels:    prometheus.Labels{"team": "Infra", "repo": "provisioner"},
+		Value:     3,
+		Timestamp: at,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("Wanted 1 sample got %d", len(got))
+	}
+
+	wantLabels := []string{"__name__=github_deployments_total", "repo=provisioner", "team=Infra"}
+	for i, label := range wantLabels {
+		if got[0].Labels[i] != label {
+			t.Errorf("Wanted label %s got %s", label, got[0].Labels[i])
+		}
+	}
+	if got[0].Value != 3 || got[0].Timestamp != at.UnixMilli() {
+		t.Errorf("Wanted 3@%d got %v@%d", at.UnixMilli(), got[0].Value, got[0].Timestamp)
+	}
+}
+
+func TestRemoteWriterError(t *testing.T) {
+	prom.SetLogger(log.NewLogfmtLogger(os.Stderr))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	writer, _ := prom.NewRemoteWriter(config.RemoteWrite{Url: server.URL})
+	err := writer.Write([]prom.Sample{{Name: "jira_incidents", Value: 1, Timestamp: time.Now()}})
+	if err == nil {
+		t.Error("Wanted error for rejected samples")
+	}
+}
+
+func TestPushEvents(t *testing.T) {
+	prom.SetLogger(log.NewNopLogger())
+
+	var mu sync.Mutex
+	var got []decodedSample
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed, _ := io.ReadAll(r.Body)
+		body, _ := snappy.Decode(nil, compressed)
+		mu.Lock()
+		got = append(got, decodeWriteRequest(t, body)...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	writer, _ := prom.NewRemoteWriter(config.RemoteWrite{Url: server.URL})
+	writer.Start()
+	prom.SetRemoteWriter(writer)
+	defer prom.SetRemoteWriter(nil)
+
+	labels := prometheus.Labels{"repo": "provisioner", "environment": "production", "team": "Infra", "status": "success"}
+	live := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	// delayed and backfilled events keep their own time
+	delayed := time.Date(2022, 9, 15, 5, 57, 2, 0, time.UTC)
+	prom.PushDeployment("deploy-2", labels, live)
+	prom.PushLeadTime("deploy-2", labels, live, 3600)
+	prom.PushDeployment("deploy-1", labels, delayed)
+	prom.PushRestoreTime("jira/INF-1", prometheus.Labels{"project": "INF", "team": "Infra"}, delayed, 7200)
+	writer.Stop()
+
+	examples := []struct {
+		Name      string
+		Id        string
+		Value     float64
+		Timestamp time.Time
+	}{
+		{Name: "dora_deployment", Id: "deploy-2", Value: 1, Timestamp: live},
+		{Name: "dora_deployment_lead_time_seconds", Id: "deploy-2", Value: 3600, Timestamp: live},
+		{Name: "dora_deployment", Id: "deploy-1", Value: 1, Timestamp: delayed},
+		{Name: "dora_incident_restore_seconds", Id: "jira/INF-1", Value: 7200, Timestamp: delayed},
+	}
+	if len(got) != len(examples) {
+		t.Fatalf("Wanted %d samples got %d", len(examples), len(got))
+	}
+	for i, example := range examples {
+		sample := got[i]
+		if sample.Labels[0] != "__name__="+example.Name || !contains(sample.Labels, "id="+example.Id) {
+			t.Errorf("Wanted %s of %s got %v", example.Name, example.Id, sample.Labels)
+		}
+		if sample.Value != example.Value || sample.Timestamp != example.Timestamp.UnixMilli() {
+			t.Errorf("%s: wanted %v@%d got %v@%d", example.Name, example.Value, example.Timestamp.UnixMilli(), sample.Value, sample.Timestamp)
+		}
+	}
+}
+
+func contains(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package tracker
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// CorrelationLink attributes incident to the deployment it is explicitly linked to
+	CorrelationLink = "link"
+	// CorrelationHeuristic attributes incident to the last production deployment of the team
+	CorrelationHeuristic = "heuristic"
+)
+
+// Shortest abbreviated SHA matched against deployed commits
+const minShaLength = 7
+
+var (
+	productionEnvironment = "production"
+	correlationWindow     = 24 * time.Hour
+)
+
+// SetCorrelation sets environment and the time before incident creation searched for its cause,
+// window not greater than zero disables attribution by heuristic
+func SetCorrelation(environment string, window time.Duration) {
+	productionEnvironment = environment
+	correlationWindow = window
+}
+
+// FindCause returns deployment the incident is linked to by deployment id, SHA or version.
+// Without links it is the last production deployment of the team within correlation window,
+// deployment of the repository named like the incident project is preferred.
+func FindCause(incident events.Event, links []string) (events.Event, string, bool) {
+	store := events.GetStore()
+	if store == nil {
+		return events.Event{}, "", false
+	}
+
+	if len(links) > 0 {
+		if d, ok := findLinked(store.Query(events.Query{Type: events.Deployment}), incident.Time, links); ok {
+			return d, CorrelationLink, true
+		}
+	}
+
+	if correlationWindow <= 0 || incident.Team == "" || incident.Team == catalog.UnknownTeam {
+		return events.Event{}, "", false
+	}
+	deployments := store.Query(events.Query{
+		Type:        events.Deployment,
+		Team:        incident.Team,
+		Environment: productionEnvironment,
+		Since:       incident.Time.Add(-correlationWindow),
+		Until:       incident.Time,
+	})
+
+	var cause events.Event
+	found := false
+	// deployments are ordered by time, the last one wins
+	for _, d := range deployments {
+		if d.Status != "success" && !d.Failed {
+			continue
+		}
+		if found && sameRepo(cause, incident) && !sameRepo(d, incident) {
+			continue
+		}
+		cause, found = d, true
+	}
+	return cause, CorrelationHeuristic, found
+}
+
+func sameRepo(d, incident events.Event) bool {
+	return incident.Project != "" && strings.EqualFold(d.Repo, incident.Project)
+}
+
+// findLinked returns deployment matching any link, production deployments and
+// the last deployment before incident are preferred when several match
+func findLinked(deployments []events.Event, at time.Time, links []string) (events.Event, bool) {
+	var linked events.Event
+	found := false
+	for _, d := range deployments {
+		if !matchesLink(d, links) {
+			continue
+		}
+		if found && better(linked, d, at) {
+			continue
+		}
+		linked, found = d, true
+	}
+	return linked, found
+}
+
+// better reports whether deployment a is a more likely cause than b
+func better(a, b events.Event, at time.Time) bool {
+	aProduction, bProduction := a.Environment == productionEnvironment, b.Environment == productionEnvironment
+	if aProduction != bProduction {
+		return aProduction
+	}
+	aBefore, bBefore := !a.Time.After(at), !b.Time.After(at)
+	if aBefore != bBefore {
+		return aBefore
+	}
+	return a.Time.After(b.Time)
+}
+
+func matchesLink(d events.Event, links []string) bool {
+	for _, link := range links {
+		link = strings.TrimSpace(link)
+		switch {
+		case link == "":
+			continue
+		case link == d.Id, d.Version != "" && link == d.Version:
+			return true
+		case len(link) >= minShaLength && d.Sha != "" && strings.HasPrefix(strings.ToLower(d.Sha), strings.ToLower(link)):
+			return true
+		}
+	}
+	return false
+}
+
+// Correlate attributes incident to the deployment which caused it. Incident linked explicitly keeps
+// its deployment, heuristic attribution is replaced once a link is known.
+func Correlate(incident *events.Event, links []string) {
+	if incident.Correlation == CorrelationLink || (incident.Deployment != "" && len(links) == 0) {
+		return
+	}
+
+	cause, correlation, ok := FindCause(*incident, links)
+	if !ok || (correlation == CorrelationHeuristic && incident.Deployment != "") {
+		return
+	}
+	blamed := incident.Deployment
+	incident.Deployment = cause.Id
+	incident.Correlation = correlation
+
+	level.Info(logger).Log("incident", incident.Id, "deployment", cause.Id, "correlation", correlation)
+	if correlation == CorrelationHeuristic {
+		markSuspected(cause)
+		return
+	}
+	MarkFailed(cause, "incident")
+	if blamed != "" && blamed != cause.Id {
+		unmarkSuspected(blamed, incident.Id)
+	}
+}
+
+// markSuspected marks deployment attributed by heuristic as failed change without counting it,
+// the attribution may be replaced by a link later
+func markSuspected(d events.Event) {
+	if d.Failed || d.FailureReason != "" {
+		return
+	}
+	d.Failed = true
+	d.FailureReason = "incident"
+	d.Correlation = CorrelationHeuristic
+	events.Record(d)
+}
+
+// unmarkSuspected reverts heuristic failure of the deployment once no incident except the relinked one blames it
+func unmarkSuspected(id, relinked string) {
+	d, ok := events.Get(id)
+	if !ok || d.Correlation != CorrelationHeuristic {
+		return
+	}
+	for _, i := range events.GetStore().Query(events.Query{Type: events.Incident, Team: d.Team}) {
+		if i.Id != relinked && i.Deployment == id {
+			return
+		}
+	}
+	d.Failed = false
+	d.FailureReason = ""
+	d.Correlation = ""
+	events.Record(d)
+	level.Info(logger).Log("deployment", id, "correlation", "unmarked", "incident", relinked)
+}
+
+// MarkFailed marks recorded deployment as failed change and counts it in deployments_failed_total,
+// deployment is counted once regardless of the amount of failures attributed to it.
+// Deployment attributed by heuristic before is counted now.
+func MarkFailed(d events.Event, reason string) {
+	if d.FailureReason != "" && d.Correlation != CorrelationHeuristic {
+		return
+	}
+	d.Failed = true
+	d.FailureReason = reason
+	d.Correlation = ""
+	events.Record(d)
+
+	labels := prometheus.Labels{
+		"repo":        d.Repo,
+		"environment": d.Environment,
+		"team":        d.Team,
+		"reason":      reason,
+	}
+	parentTeam, department := catalog.GetParentTeams(cat, d.Team)
+	prom.SetHierarchyLabels(labels, parentTeam, department)
+	prom.IncDeploymentsFailed(labels)
+}
@@ -0,0 +1,133 @@
+package tracker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/internal/testenv"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var incidentTime = time.Date(2021, 4, 28, 12, 0, 0, 0, time.UTC)
+
+func setup(t *testing.T) (*events.Store, *prom.Exporter) {
+	store, exporter := testenv.Setup(t)
+	tracker.SetCatalog(catalog.NewCatalogFromYaml("- name: Payments\n  services: [Payments API]\n"))
+	tracker.SetCorrelation("production", 24*time.Hour)
+
+	for _, d := range []events.Event{
+		{Id: "payments-1", Repo: "payments", Environment: "production", Sha: "1111111aaaa", Time: incidentTime.Add(-30 * time.Hour)},
+		{Id: "payments-2", Repo: "payments", Environment: "production", Sha: "2222222bbbb", Version: "v1.2.0", Time: incidentTime.Add(-3 * time.Hour)},
+		{Id: "ledger-1", Repo: "ledger", Environment: "production", Sha: "3333333cccc", Time: incidentTime.Add(-time.Hour)},
+		{Id: "payments-staging", Repo: "payments", Environment: "staging", Sha: "4444444dddd", Time: incidentTime.Add(-time.Minute)},
+	} {
+		d.Type, d.Source, d.Team, d.Status = events.Deployment, "github", "Payments", "success"
+		events.Record(d)
+	}
+	return store, exporter
+}
+
+func incident(id, project string, links ...string) tracker.Incident {
+	return tracker.Incident{Id: id, Source: "pagerduty", Time: incidentTime, Project: project, Team: "Payments", Status: "triggered", Links: links}
+}
+
+func TestCorrelateHeuristic(t *testing.T) {
+	store, exporter := setup(t)
+
+	tracker.RecordIncident(incident("pagerduty/P1", "payments"))
+	// another incident caused by the same deployment doesn't count it twice
+	tracker.RecordIncident(incident("pagerduty/P2", "Payments API"))
+
+	i, _ := store.Get("pagerduty/P1")
+	if i.Deployment != "payments-2" || i.Correlation != tracker.CorrelationHeuristic {
+		t.Errorf("deployment of the incident project is expected, got %s by %s", i.Deployment, i.Correlation)
+	}
+	i, _ = store.Get("pagerduty/P2")
+	if i.Deployment != "ledger-1" {
+		t.Errorf("the last production deployment of the team is expected, got %s", i.Deployment)
+	}
+	d, _ := store.Get("payments-2")
+	if !d.Failed || d.FailureReason != "incident" || d.Correlation != tracker.CorrelationHeuristic {
+		t.Errorf("deployment isn't marked failed: %+v", d)
+	}
+
+	// heuristic attribution isn't counted until it is linked
+	if got := testenv.Value(t, exporter, "github_deployments_failed_total", nil); got != 0 {
+		t.Errorf("Wanted no counted failures got %v", got)
+	}
+	tracker.RecordIncident(incident("pagerduty/P3", "payments", "payments-2"))
+	d, _ = store.Get("payments-2")
+	if !d.Failed || d.Correlation != "" {
+		t.Errorf("linked deployment isn't marked failed: %+v", d)
+	}
+	labels := prometheus.Labels{"environment": "production", "reason": "incident", "repo": "payments", "team": "Payments"}
+	if got := testenv.Value(t, exporter, "github_deployments_failed_total", labels); got != 1 {
+		t.Errorf("Wanted linked deployment counted once got %v", got)
+	}
+	if got := testenv.Value(t, exporter, "github_deployments_failed_total", nil); got != 1 {
+		t.Errorf("Wanted only linked deployment counted got %v", got)
+	}
+}
+
+func TestCorrelateLink(t *testing.T) {
+	store, exporter := setup(t)
+
+	tracker.RecordIncident(incident("pagerduty/P1", "payments"))
+	// link added later replaces heuristic attribution
+	tracker.RecordIncident(incident("pagerduty/P1", "payments", "1111111"))
+	// and isn't replaced by another delivery without it
+	tracker.RecordIncident(incident("pagerduty/P1", "payments"))
+
+	i, _ := store.Get("pagerduty/P1")
+	if i.Deployment != "payments-1" || i.Correlation != tracker.CorrelationLink {
+		t.Errorf("linked deployment is expected, got %s by %s", i.Deployment, i.Correlation)
+	}
+	// wrongly blamed deployment is unmarked
+	if d, _ := store.Get("payments-2"); d.Failed || d.FailureReason != "" || d.Correlation != "" {
+		t.Errorf("heuristic failure isn't reverted: %+v", d)
+	}
+	if d, _ := store.Get("payments-1"); !d.Failed || d.FailureReason != "incident" {
+		t.Errorf("linked deployment isn't marked failed: %+v", d)
+	}
+	if got := testenv.Value(t, exporter, "github_deployments_failed_total", prometheus.Labels{"repo": "payments"}); got != 1 {
+		t.Errorf("Wanted only linked deployment counted got %v", got)
+	}
+
+	tracker.RecordIncident(incident("pagerduty/P2", "payments", "v1.2.0"))
+	i, _ = store.Get("pagerduty/P2")
+	if i.Deployment != "payments-2" {
+		t.Errorf("deployment linked by version is expected, got %s", i.Deployment)
+	}
+}
+
+func TestCorrelateLinkKeepsSharedHeuristic(t *testing.T) {
+	store, _ := setup(t)
+
+	tracker.RecordIncident(incident("pagerduty/P1", "payments"))
+	tracker.RecordIncident(incident("pagerduty/P2", "payments"))
+	tracker.RecordIncident(incident("pagerduty/P1", "payments", "payments-1"))
+
+	// P2 still blames the deployment by heuristic
+	if d, _ := store.Get("payments-2"); !d.Failed || d.Correlation != tracker.CorrelationHeuristic {
+		t.Errorf("deployment blamed by another incident is unmarked: %+v", d)
+	}
+}
+
+func TestCorrelateOutsideWindow(t *testing.T) {
+	store, exporter := setup(t)
+	tracker.SetCorrelation("production", time.Minute)
+
+	tracker.RecordIncident(incident("pagerduty/P1", "payments"))
+
+	i, _ := store.Get("pagerduty/P1")
+	if i.Deployment != "" {
+		t.Errorf("no deployment is expected, got %s", i.Deployment)
+	}
+	if got := testenv.Value(t, exporter, "github_deployments_failed_total", nil); got != 0 {
+		t.Errorf("Wanted no counted failures got %v", got)
+	}
+}
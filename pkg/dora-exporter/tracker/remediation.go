@@ -0,0 +1,134 @@
+package tracker
+
+import (
+	"path"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+)
+
+const (
+	// ReasonRollback marks deployment replaced by an earlier commit
+	ReasonRollback = "rollback"
+	// ReasonHotfix marks deployment followed by a hotfix
+	ReasonHotfix = "hotfix"
+)
+
+// AncestorLookup reports whether commit ancestor is reachable from sha of repository
+type AncestorLookup func(repository, ancestor, sha string) (bool, error)
+
+var ancestorLookups = map[string]AncestorLookup{}
+
+// SetAncestorLookup registers lookup of the git provider, e.g. github
+func SetAncestorLookup(provider string, lookup AncestorLookup) {
+	ancestorLookups[provider] = lookup
+}
+
+var hotfixBranches, hotfixLabels []string
+
+// SetHotfix sets patterns of deployed branches and labels of the change selecting hotfixes
+func SetHotfix(branches, labels []string) {
+	hotfixBranches = branches
+	hotfixLabels = labels
+}
+
+// HotfixLabels reports whether hotfixes are selected by labels, so sources need labels of the change
+func HotfixLabels() bool {
+	return len(hotfixLabels) > 0
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(value)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IsHotfix reports whether deployed ref or any label of the change matches hotfix patterns
+func (d Deployment) IsHotfix() bool {
+	if d.Ref != "" && matchAny(hotfixBranches, d.Ref) {
+		return true
+	}
+	for _, label := range d.ChangeLabels {
+		if matchAny(hotfixLabels, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// previousDeployments returns successful deployments of the repository to the environment before d,
+// the last one first
+func previousDeployments(d Deployment) []events.Event {
+	store := events.GetStore()
+	if store == nil {
+		return nil
+	}
+	deployments := store.Query(events.Query{
+		Type:        events.Deployment,
+		Repo:        d.Repo,
+		Environment: d.Environment,
+		Until:       d.Time,
+	})
+
+	var previous []events.Event
+	for i := len(deployments) - 1; i >= 0; i-- {
+		if deployments[i].Id != d.Id && deployments[i].Status == "success" {
+			previous = append(previous, deployments[i])
+		}
+	}
+	return previous
+}
+
+// isRollback reports whether d deploys sha deployed before the last deployment or an ancestor of its sha
+func isRollback(d Deployment, previous []events.Event) bool {
+	last := previous[0]
+	if d.Sha == "" || last.Sha == "" || strings.EqualFold(d.Sha, last.Sha) {
+		return false
+	}
+	for _, earlier := range previous[1:] {
+		if strings.EqualFold(d.Sha, earlier.Sha) {
+			return true
+		}
+	}
+
+	lookup, ok := ancestorLookups[d.Provider]
+	if !ok {
+		return false
+	}
+	repository := d.Repository
+	if repository == "" {
+		repository = d.Repo
+	}
+	ancestor, err := lookup(repository, d.Sha, last.Sha)
+	if err != nil {
+		level.Warn(logger).Log("repository", repository, "sha", d.Sha, "previous", last.Sha, "ancestor", "unknown", "error", err)
+		return false
+	}
+	return ancestor
+}
+
+// detectRemediation marks the last deployment of the repository to the environment
+// as failed change when d rolls it back or is a hotfix
+func detectRemediation(d Deployment) {
+	previous := previousDeployments(d)
+	if len(previous) == 0 {
+		return
+	}
+
+	var reason string
+	switch {
+	case isRollback(d, previous):
+		reason = ReasonRollback
+	case d.IsHotfix():
+		reason = ReasonHotfix
+	default:
+		return
+	}
+
+	level.Info(logger).Log("deployment", previous[0].Id, "remediated_by", d.Id, "reason", reason)
+	MarkFailed(previous[0], reason)
+}
@@ -0,0 +1,107 @@
+package tracker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/internal/testenv"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/tracker"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// deployment of checkout to production at incidentTime plus At, Reason is expected after all of them
+type deployment struct {
+	Id         string
+	Sha        string
+	At         time.Duration
+	Deployment tracker.Deployment
+	Reason     string
+}
+
+func deploy(examples []deployment) {
+	for _, example := range examples {
+		d := example.Deployment
+		d.Id, d.Sha, d.Time = example.Id, example.Sha, incidentTime.Add(example.At)
+		d.Source, d.Repo, d.Environment, d.Team = "github", "checkout", "production", "Payments"
+		if d.Status == "" {
+			d.Status = "success"
+		}
+		tracker.RecordDeployment(d)
+	}
+}
+
+func TestRollbackToEarlierDeploy(t *testing.T) {
+	store, exporter := setup(t)
+	tracker.SetHotfix(nil, nil)
+
+	examples := []deployment{
+		{Id: "checkout-1", Sha: "aaaaaaa"},
+		{Id: "checkout-2", Sha: "bbbbbbb", At: time.Hour},
+		// redeploy of the same commit isn't a rollback
+		{Id: "checkout-3", Sha: "bbbbbbb", At: 2 * time.Hour, Reason: tracker.ReasonRollback},
+		{Id: "checkout-4", Sha: "aaaaaaa", At: 3 * time.Hour, Deployment: tracker.Deployment{Status: "in_progress"}},
+		{Id: "checkout-4", Sha: "aaaaaaa", At: 3 * time.Hour},
+	}
+	deploy(examples)
+
+	for _, example := range examples {
+		if d, _ := store.Get(example.Id); d.FailureReason != example.Reason || d.Failed != (example.Reason != "") {
+			t.Errorf("%s: expected failure reason %q, got %+v", example.Id, example.Reason, d)
+		}
+	}
+
+	labels := prometheus.Labels{"environment": "production", "reason": tracker.ReasonRollback, "repo": "checkout", "team": "Payments"}
+	if got := testenv.Value(t, exporter, "github_deployments_failed_total", labels); got != 1 {
+		t.Errorf("Wanted 1 rolled back deployment got %v", got)
+	}
+	if got := testenv.Value(t, exporter, "github_deployments_failed_total", nil); got != 1 {
+		t.Errorf("Wanted only rolled back deployment counted got %v", got)
+	}
+}
+
+func TestRollbackToAncestor(t *testing.T) {
+	store, _ := setup(t)
+	tracker.SetHotfix(nil, nil)
+	tracker.SetAncestorLookup("git", func(repository, ancestor, sha string) (bool, error) {
+		if repository != "acme/checkout" {
+			t.Errorf("Unexpected repository %s", repository)
+		}
+		return ancestor == "0000000" && sha == "ccccccc", nil
+	})
+
+	git := tracker.Deployment{Provider: "git", Repository: "acme/checkout"}
+	examples := []deployment{
+		// rolled back to its ancestor
+		{Id: "checkout-1", Sha: "ccccccc", Reason: tracker.ReasonRollback},
+		// forward deployment isn't a rollback
+		{Id: "checkout-2", Sha: "0000000", At: time.Hour, Deployment: git},
+		{Id: "checkout-3", Sha: "ddddddd", At: 2 * time.Hour, Deployment: git},
+	}
+	deploy(examples)
+
+	for _, example := range examples {
+		if d, _ := store.Get(example.Id); d.FailureReason != example.Reason {
+			t.Errorf("%s: expected failure reason %q, got %+v", example.Id, example.Reason, d)
+		}
+	}
+}
+
+func TestHotfix(t *testing.T) {
+	store, _ := setup(t)
+	tracker.SetHotfix([]string{"hotfix/*"}, []string{"hotfix"})
+	defer tracker.SetHotfix(nil, nil)
+
+	examples := []deployment{
+		{Id: "checkout-1", Sha: "aaaaaaa", Deployment: tracker.Deployment{Ref: "main"}, Reason: tracker.ReasonHotfix},
+		{Id: "checkout-2", Sha: "bbbbbbb", At: time.Hour, Deployment: tracker.Deployment{Ref: "hotfix/payment-form"}, Reason: tracker.ReasonHotfix},
+		{Id: "checkout-3", Sha: "ccccccc", At: 2 * time.Hour, Deployment: tracker.Deployment{Ref: "main", ChangeLabels: []string{"bug", "HotFix"}}},
+		{Id: "checkout-4", Sha: "ddddddd", At: 3 * time.Hour, Deployment: tracker.Deployment{Ref: "main", ChangeLabels: []string{"feature"}}},
+	}
+	deploy(examples)
+
+	for _, example := range examples {
+		if d, _ := store.Get(example.Id); d.FailureReason != example.Reason {
+			t.Errorf("%s: expected failure reason %q, got %q", example.Id, example.Reason, d.FailureReason)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Package tracker records deployments and incidents received from any source
+// into metrics, remote write and the event log
+package tracker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/catalog"
+	"github.com/mprokopov/dora-exporter/pkg/dora-exporter/events"
+	prom "github.com/mprokopov/dora-exporter/pkg/dora-exporter/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var logger log.Logger
+
+func SetLogger(log log.Logger) {
+	logger = log
+	return
+}
+
+var cat catalog.TeamsCatalog
+
+// SetCatalog sets catalog used to resolve parent teams of the recorded events
+func SetCatalog(catalog catalog.TeamsCatalog) {
+	cat = catalog
+}
+
+// Deployment is a deployment status reported by any source
+type Deployment struct {
+	// Source specific identifier, e.g. github/123
+	Id          string
+	Source      string
+	Time        time.Time
+	Repo        string
+	Environment string
+	Team        string
+	// Catalog provider which resolved the team
+	Catalog string
+	Status  string
+	Sha     string
+	// Released version like a tag, empty for deployments of a commit
+	Version string
+	// Deployed branch or tag
+	Ref string
+	// Labels of the deployed change like pull request labels
+	ChangeLabels []string
+	// Git provider and repository as it identifies it, Repo when empty. Used to detect rollbacks to ancestor commits
+	Provider   string
+	Repository string
+	// Lead time in seconds, recorded only when HasLeadTime is set
+	LeadTime    float64
+	HasLeadTime bool
+	Failed      bool
+	Exemplar    prometheus.Labels
+	// Lookup errors happened while processing the deployment
+	Errors []string
+}
+
+// Labels returns metric labels of the deployment
+func (d Deployment) Labels() prometheus.Labels {
+	labels := prometheus.Labels{
+		"repo":        d.Repo,
+		"environment": d.Environment,
+		"team":        d.Team,
+		"status":      d.Status,
+	}
+	parentTeam, department := catalog.GetParentTeams(cat, d.Team)
+	prom.SetHierarchyLabels(labels, parentTeam, department)
+	return labels
+}
+
+// RecordDeployment counts deployment, adds its lead time, pushes samples
+// to remote write and records the event. Successful rollback or hotfix marks
+// the deployment it remediates as failed change. Returns labels the deployment was exported with.
+func RecordDeployment(d Deployment) prometheus.Labels {
+	labels := d.Labels()
+
+	prom.IncDeploymentsCount(labels, d.Exemplar)
+	prom.PushDeployment(d.Id, labels, d.Time)
+	if d.HasLeadTime {
+		prom.AddDeploymentsDuration(labels, d.LeadTime, d.Exemplar)
+		prom.PushLeadTime(d.Id, labels, d.Time, d.LeadTime)
+	}
+
+	event := events.Event{
+		Id:          d.Id,
+		Type:        events.Deployment,
+		Source:      d.Source,
+		Time:        d.Time,
+		Team:        d.Team,
+		Catalog:     d.Catalog,
+		Repo:        d.Repo,
+		Environment: d.Environment,
+		Status:      d.Status,
+		Sha:         d.Sha,
+		Version:     d.Version,
+		LeadTime:    d.LeadTime,
+		Failed:      d.Failed,
+		Labels:      labels,
+		Errors:      d.Errors,
+	}
+	// later statuses keep the deployment attributed as failed change
+	known, seen := events.Get(d.Id)
+	if seen && known.FailureReason != "" {
+		event.Failed = true
+		event.FailureReason = known.FailureReason
+		event.Correlation = known.Correlation
+	}
+	events.Record(event)
+
+	// redelivered status was checked already
+	if d.Status == "success" && !(seen && known.Status == "success") {
+		detectRemediation(d)
+	}
+
+	level.Info(logger).Log(
+		"source", d.Source,
+		"environment", d.Environment,
+		"repository", d.Repo,
+		"status", d.Status,
+		"team", d.Team,
+		"sha", d.Sha)
+
+	return labels
+}
+
+// CommitLookup returns date of the first commit of the change which brought sha to repository,
+// along with the related pull or merge request
+type CommitLookup func(repository, sha string) (time.Time, string, error)
+
+var commitLookups = map[string]CommitLookup{}
+
+// SetCommitLookup registers lookup of the git provider, e.g. github
+func SetCommitLookup(provider string, lookup CommitLookup) {
+	commitLookups[provider] = lookup
+}
+
+// LeadTime returns seconds between the first commit of the change and at using lookup of the provider
+func LeadTime(provider, repository, sha string, at time.Time) (float64, string, error) {
+	lookup, ok := commitLookups[provider]
+	if !ok {
+		return 0, "", fmt.Errorf("unknown git provider %q", provider)
+	}
+	firstCommitDate, change, err := lookup(repository, sha)
+	if err != nil {
+		return 0, change, err
+	}
+	return at.Sub(firstCommitDate).Seconds(), change, nil
+}
+
+// Incident is an incident reported by any source
+type Incident struct {
+	// Source specific identifier, e.g. pagerduty/Q1R2 shared by trigger and resolve events
+	Id     string
+	Source string
+	// Time when incident was triggered
+	Time time.Time
+	// Project or service the incident was opened for
+	Project string
+	Team    string
+	// Catalog provider which resolved the team
+	Catalog string
+	Status  string
+	// Time when incident was resolved, zero while it is open
+	Resolved time.Time
+	// Deployment ids, SHAs or versions the incident is explicitly linked to
+	Links []string
+	// Lookup errors happened while processing the incident
+	Errors []string
+}
+
+// Labels returns metric labels of the incident
+func (i Incident) Labels() prometheus.Labels {
+	labels := prometheus.Labels{
+		"team":    i.Team,
+		"project": i.Project,
+	}
+	parentTeam, department := catalog.GetParentTeams(cat, i.Team)
+	prom.SetHierarchyLabels(labels, parentTeam, department)
+	return labels
+}
+
+// RecordIncident counts incident the first time it is seen and adds its restore time once it is resolved.
+// Trigger time of the known incident is kept when resolve event arrives, as well as the first resolution
+// when the incident is reopened or resolved again. Returns labels the incident was exported with.
+func RecordIncident(i Incident) prometheus.Labels {
+	known, ok := events.Get(i.Id)
+	if ok && !known.Time.IsZero() {
+		i.Time = known.Time
+	}
+	if ok && known.Resolved != nil {
+		i.Resolved = *known.Resolved
+	}
+	labels := i.Labels()
+
+	if !ok {
+		prom.IncIncidentsCount(labels)
+		prom.PushIncident(i.Id, labels, i.Time)
+	}
+	if !i.Resolved.IsZero() && (!ok || known.Resolved == nil) {
+		restoreTime := i.Resolved.Sub(i.Time).Seconds()
+		prom.AddIncidentsDuration(labels, restoreTime)
+		prom.PushRestoreTime(i.Id, labels, i.Resolved, restoreTime)
+	}
+
+	event := events.Event{
+		Id:      i.Id,
+		Type:    events.Incident,
+		Source:  i.Source,
+		Time:    i.Time,
+		Team:    i.Team,
+		Catalog: i.Catalog,
+		Project: i.Project,
+		Status:  i.Status,
+		Labels:  labels,
+		Errors:  i.Errors,
+	}
+	if !i.Resolved.IsZero() {
+		resolved := i.Resolved
+		event.Resolved = &resolved
+	}
+	if ok {
+		event.Deployment, event.Correlation = known.Deployment, known.Correlation
+	}
+	Correlate(&event, i.Links)
+	events.Record(event)
+
+	level.Info(logger).Log(
+		"source", i.Source,
+		"incident", i.Id,
+		"project", i.Project,
+		"status", i.Status,
+		"team", i.Team,
+		"resolved", !i.Resolved.IsZero())
+
+	return labels
+}